@@ -1,28 +1,102 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"flag"
 	"fmt"
-	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/cache"
+	"httpfromtcp/internal/compress"
+	"httpfromtcp/internal/digest"
+	"httpfromtcp/internal/fileserver"
+	"httpfromtcp/internal/proxy"
 	"httpfromtcp/internal/request"
 	"httpfromtcp/internal/response"
 	"httpfromtcp/internal/server"
-	"io"
+	"httpfromtcp/internal/sse"
+	"httpfromtcp/internal/websocket"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 const port = 42069
 const httpbinUrl = "https://httpbin.org"
 
+var assets = os.DirFS("./assets")
+var handlerAssets = fileserver.Handler(assets, fileserver.Config{StripPrefix: "/assets", ListDirectories: true})
+var handlerEcho = websocket.Handler(echoMessages, websocket.Config{EnableCompression: true})
+var handlerEvents = sse.Handler(streamTicks, sse.Config{Retry: 2 * time.Second})
+var httpbinProxy *proxy.ReverseProxy
+
 func main() {
-	server, err := server.Serve(port, handler)
+	lenient := flag.Bool("lenient", false, "accept bare LF, extra whitespace, extension methods and obs-text")
+	upstreams := flag.String("upstreams", httpbinUrl, "comma-separated upstream URLs proxied under /httpbin")
+	balance := flag.String("balance", "round-robin", "upstream selection: round-robin, least-conn or consistent-hash")
+	hashHeader := flag.String("hash-header", "", "request header keying consistent-hash; client IP if unset")
+	forward := flag.Bool("forward-proxy", false, "also act as a forward proxy for absolute-form and CONNECT requests")
+	proxyAllow := flag.String("proxy-allow", "", "comma-separated destinations the forward proxy may reach")
+	proxyDeny := flag.String("proxy-deny", "", "comma-separated destinations the forward proxy must not reach")
+	proxyUser := flag.String("proxy-user", "", "user:pass required from forward proxy clients")
+	flag.Parse()
+
+	strategy, err := proxy.ParseStrategy(*balance)
+	if err != nil {
+		log.Fatal(err)
+	}
+	httpbinProxy, err = proxy.NewReverseProxy(proxy.Config{
+		Upstreams:       strings.Split(*upstreams, ","),
+		StripPrefix:     "/httpbin",
+		Strategy:        strategy,
+		HashHeader:      *hashHeader,
+		HealthCheck:     proxy.HealthCheck{Path: "/status/200", Interval: 30 * time.Second, Timeout: 5 * time.Second},
+		PassiveHealth:   proxy.PassiveHealth{MaxFails: 3, FailTimeout: 30 * time.Second},
+		DialTimeout:     5 * time.Second,
+		ResponseTimeout: 30 * time.Second,
+		Retry:           proxy.RetryPolicy{MaxRetries: 2, Backoff: 100 * time.Millisecond, MaxBackoff: time.Second},
+		CircuitBreaker:  proxy.CircuitBreaker{FailureThreshold: 5, OpenTimeout: 30 * time.Second},
+	})
+	if err != nil {
+		log.Fatalf("Error configuring httpbin proxy: %v", err)
+	}
+	defer httpbinProxy.Close()
+
+	config := server.Config{Port: port, Parser: request.StrictParserConfig}
+	if *lenient {
+		config.Parser = request.LenientParserConfig
+	}
+	var forwardProxy *proxy.ForwardProxy
+	if *forward {
+		forwardConfig := proxy.ForwardConfig{
+			Allow:       splitList(*proxyAllow),
+			Deny:        splitList(*proxyDeny),
+			DialTimeout: 5 * time.Second,
+		}
+		if *proxyUser != "" {
+			user, pass, _ := strings.Cut(*proxyUser, ":")
+			forwardConfig.Authenticate = func(username, password string) bool {
+				return username == user && password == pass
+			}
+		}
+		forwardProxy, err = proxy.NewForwardProxy(forwardConfig)
+		if err != nil {
+			log.Fatalf("Error configuring forward proxy: %v", err)
+		}
+	}
+	// Request digests cover the encoded body, so they are verified before decoding;
+	// response digests cover the compressed bytes, so their filter sits inside compression.
+	chain := compress.DecodeRequests(handler, compress.DefaultDecodeConfig)
+	chain = digest.VerifyRequests(chain, digest.VerifyConfig{})
+	chain = cache.Middleware(chain, cache.Config{})
+	chain = httpbinDigest(chain)
+	chain = digest.Middleware(chain, digest.Config{})
+	chain = compress.Middleware(chain, compress.DefaultConfig)
+	if forwardProxy != nil {
+		chain = proxy.ForwardRequests(chain, forwardProxy)
+	}
+	server, err := server.ServeWithConfig(config, chain)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
@@ -35,9 +109,44 @@ func main() {
 	fmt.Println("Server gracefully stopped")
 }
 
+// httpbinDigest always sends Content-Digest for /httpbin. It sits outside the
+// cache so the digest is also computed for responses served from it.
+func httpbinDigest(next server.Handler) server.Handler {
+	withDigest := digest.Middleware(next, digest.Config{
+		Algorithms:    []string{"sha-256", "sha-512"},
+		ContentDigest: true,
+	})
+	return func(w *response.Writer, req *request.Request) {
+		if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin") {
+			withDigest(w, req)
+			return
+		}
+		next(w, req)
+	}
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
 func handler(w *response.Writer, req *request.Request) {
 	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin") {
-		handlerHttpbin(w, req)
+		httpbinProxy.Handle(w, req)
+		return
+	}
+	if strings.HasPrefix(req.RequestLine.RequestTarget, "/assets/") {
+		handlerAssets(w, req)
+		return
+	}
+	if req.RequestLine.RequestTarget == "/ws" {
+		handlerEcho(w, req)
+		return
+	}
+	if req.RequestLine.RequestTarget == "/events" {
+		handlerEvents(w, req)
 		return
 	}
 	if req.RequestLine.RequestTarget == "/video" {
@@ -57,70 +166,38 @@ func handler(w *response.Writer, req *request.Request) {
 }
 
 func handlerVideo(w *response.Writer, req *request.Request) {
-	w.WriteStatusLine(response.StatusCodeSuccess)
-	body, err := os.ReadFile("./assets/vim.mp4")
-	if err != nil {
-		fmt.Errorf("error whilst reading vim video, %s", err)
-	}
-	headers := response.GetDefaultHeaders(len(body))
-	headers.Override("Content-Type", "video/mp4")
-	w.WriteHeaders(headers)
-	w.WriteBody(body)
+	fileserver.ServeFile(w, req, assets, "vim.mp4")
 }
 
-func handlerHttpbin(w *response.Writer, req *request.Request) {
-	s := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin")
-	fullUrl := httpbinUrl + s
-	resp, err := http.Get(fullUrl)
-	if err != nil {
-		handler500(w, req)
+func echoMessages(c *websocket.Conn, _ *request.Request) {
+	for {
+		op, data, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := c.WriteMessage(op, data); err != nil {
+			return
+		}
 	}
-	defer resp.Body.Close()
+}
 
-	w.WriteStatusLine(response.StatusCodeSuccess)
-	h := response.GetDefaultHeaders(0)
-	h.Remove("Content-Length")
-	h.Override("Transfer-Encoding", "chunked")
-	h.Set("Trailer", "X-Content-SHA256")
-	h.Set("Trailer", "X-Content-Length")
-	w.WriteHeaders(h)
-
-	buf := make([]byte, 1024)
-	totalBody := []byte("")
+// streamTicks sends a numbered tick every second, continuing after the last
+// tick a reconnecting client saw.
+func streamTicks(s *sse.Writer, _ *request.Request) {
+	n, _ := strconv.Atoi(s.LastEventID())
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 	for {
-		n, err := resp.Body.Read(buf)
-		fmt.Println("Read", n, "bytes")
-		if n > 0 {
-			_, err = w.WriteChunkedBody(buf[:n])
-			if err != nil {
-				fmt.Println("Error writing chunked body:", err)
-				break
+		select {
+		case <-s.Done():
+			return
+		case <-ticker.C:
+			n++
+			if err := s.Send(sse.Event{ID: strconv.Itoa(n), Event: "tick", Data: time.Now().UTC().Format(time.RFC3339)}); err != nil {
+				return
 			}
-			totalBody = append(totalBody, buf[:n]...)
-		}
-		if err == io.EOF {
-			break // all data read
-		}
-		if err != nil {
-			fmt.Println("Error reading response body:", err)
-			break
 		}
 	}
-	_, err = w.WriteChunkedBodyDone()
-	if err != nil {
-		fmt.Println("Error writing chunked body done:", err)
-	}
-	bodyHash := sha256.Sum256(totalBody)
-	trailers := headers.NewHeaders()
-	trailers.Set("X-Content-Length", strconv.Itoa(len(totalBody)))
-	trailers.Set("X-Content-SHA256", hex.EncodeToString(bodyHash[:]))
-	err = w.WriteTrailers(trailers)
-	if err != nil {
-		err = fmt.Errorf("error whilst writing trailers to client, %s", err)
-		log.Println(err)
-	}
-	return
-
 }
 
 func handler400(w *response.Writer, _ *request.Request) {
@@ -0,0 +1,494 @@
+package cache
+
+import (
+	"fmt"
+	"httpfromtcp/internal/conditional"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Storage holds the entries; nil means a MemoryStorage of DefaultMaxBytes.
+	Storage Storage
+	// MaxObjectSize is the largest body that is stored; 0 means DefaultMaxObjectSize.
+	MaxObjectSize int
+	// Private makes this a private cache, which may store responses marked
+	// private and ignores s-maxage.
+	Private bool
+}
+
+const (
+	DefaultMaxBytes      = 64 << 20
+	DefaultMaxObjectSize = 1 << 20
+)
+
+// cacheStatusName identifies this cache in Cache-Status (RFC 9211).
+const cacheStatusName = "httpfromtcp"
+
+// unstoredHeaders describe a single message rather than the stored
+// response; framing is recomputed whenever an entry is served.
+var unstoredHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Transfer-Encoding",
+	"Trailer",
+	"Content-Length",
+	"Cache-Status",
+}
+
+// Cache is an RFC 9111 HTTP cache in front of a handler. It stores responses
+// as the handler produced them, before the body filters added by outer
+// middleware, and serves hits through those same filters. Revalidation calls
+// the handler directly, so stored and refreshed entries stay the same
+// representation.
+type Cache struct {
+	next          server.Handler
+	storage       Storage
+	maxObjectSize int
+	shared        bool
+	now           func() time.Time
+
+	mu           sync.Mutex
+	revalidating map[string]bool
+	// invalidated records when each key was last invalidated, so that
+	// responses requested before then are not stored again
+	invalidated map[string]time.Time
+}
+
+func New(next server.Handler, config Config) *Cache {
+	storage := config.Storage
+	if storage == nil {
+		storage = NewMemoryStorage(DefaultMaxBytes)
+	}
+	maxObjectSize := config.MaxObjectSize
+	if maxObjectSize == 0 {
+		maxObjectSize = DefaultMaxObjectSize
+	}
+	return &Cache{
+		next:          next,
+		storage:       storage,
+		maxObjectSize: maxObjectSize,
+		shared:        !config.Private,
+		now:           time.Now,
+		revalidating:  map[string]bool{},
+		invalidated:   map[string]time.Time{},
+	}
+}
+
+func Middleware(next server.Handler, config Config) server.Handler {
+	return New(next, config).Handle
+}
+
+func (c *Cache) Handle(w *response.Writer, req *request.Request) {
+	method := req.RequestLine.Method
+	if method != "GET" && method != "HEAD" {
+		if !req.MethodInfo().Safe {
+			w.AddInnerBodyFilter(func(statusCode response.StatusCode, h headers.Headers) func(io.Writer) io.WriteCloser {
+				// RFC 9111 section 4.4: a non-error response to an unsafe
+				// method invalidates the target
+				if statusCode >= 200 && statusCode < 400 {
+					c.invalidate(cacheKey(req))
+				}
+				return nil
+			})
+		}
+		c.next(w, req)
+		return
+	}
+	if _, ok := req.Headers.Get("Range"); ok {
+		// partial responses are neither stored nor built from stored ones
+		c.next(w, req)
+		return
+	}
+	if _, err := req.ReadBody(); err != nil {
+		response.Error(w, response.StatusCodeBadRequest, err.Error())
+		return
+	}
+
+	key := cacheKey(req)
+	reqCC := parseCacheControl(req.Headers)
+	// Pragma only counts when Cache-Control is absent (RFC 9111 section 5.4)
+	noCache := reqCC.has("no-cache") || (!hasCacheControl(req) && req.Headers.HasToken("Pragma", "no-cache"))
+	entry, varyMiss := c.lookup(key, req)
+	if entry == nil {
+		if reqCC.has("only-if-cached") {
+			response.Error(w, response.StatusCodeGatewayTimeout, "")
+			return
+		}
+		status := "fwd=uri-miss"
+		if varyMiss {
+			status = "fwd=vary-miss"
+		}
+		c.fetch(w, req, key, status)
+		return
+	}
+
+	age := entry.age(c.now())
+	ttl := entry.freshnessLifetime(c.shared) - age
+	cc := parseCacheControl(entry.Header)
+	if !noCache && !cc.has("no-cache") && satisfiesRequest(reqCC, age, ttl) {
+		hit := fmt.Sprintf("hit; ttl=%d", int(ttl/time.Second))
+		switch {
+		case ttl > 0:
+			c.serve(w, req, entry, age, hit)
+			return
+		case !c.staleAllowed(cc):
+		case withinMaxStale(reqCC, -ttl):
+			c.serve(w, req, entry, age, hit)
+			return
+		case withinDirective(cc, "stale-while-revalidate", -ttl):
+			c.serve(w, req, entry, age, hit)
+			c.revalidateInBackground(key, req, entry)
+			return
+		}
+	}
+	if reqCC.has("only-if-cached") {
+		response.Error(w, response.StatusCodeGatewayTimeout, "")
+		return
+	}
+	if !hasValidator(entry) {
+		c.fetch(w, req, key, "fwd=stale")
+		return
+	}
+	fresh, fwdStatus, err := c.revalidate(key, req, entry)
+	if err != nil {
+		log.Printf("cache: revalidating %s failed: %v", key, err)
+		response.Error(w, response.StatusCodeBadGateway, "")
+		return
+	}
+	if fresh == nil {
+		// too large to hold; the client gets it straight from next
+		c.fetch(w, req, key, "fwd=stale")
+		return
+	}
+	c.serve(w, req, fresh, fresh.age(c.now()), "fwd=stale; fwd-status="+strconv.Itoa(int(fwdStatus)))
+}
+
+func hasCacheControl(req *request.Request) bool {
+	_, ok := req.Headers.Get("Cache-Control")
+	return ok
+}
+
+// satisfiesRequest applies the request's max-age and min-fresh limits.
+func satisfiesRequest(reqCC directives, age, ttl time.Duration) bool {
+	if maxAge, ok := reqCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := reqCC.seconds("min-fresh"); ok && ttl < minFresh {
+		return false
+	}
+	return true
+}
+
+// staleAllowed reports whether the response permits being served stale.
+func (c *Cache) staleAllowed(cc directives) bool {
+	return !cc.has("must-revalidate") && !(c.shared && cc.has("proxy-revalidate"))
+}
+
+// withinMaxStale reports whether the client accepts a response this stale.
+// max-stale without an argument accepts any staleness.
+func withinMaxStale(reqCC directives, staleness time.Duration) bool {
+	if arg, ok := reqCC["max-stale"]; ok && arg == "" {
+		return true
+	}
+	return withinDirective(reqCC, "max-stale", staleness)
+}
+
+func withinDirective(d directives, name string, staleness time.Duration) bool {
+	limit, ok := d.seconds(name)
+	return ok && staleness <= limit
+}
+
+func hasValidator(e *Entry) bool {
+	_, hasETag := e.Header.Get("ETag")
+	_, hasLastModified := e.Header.Get("Last-Modified")
+	return hasETag || hasLastModified
+}
+
+func cacheKey(req *request.Request) string {
+	host, _ := req.Headers.Get("Host")
+	return strings.ToLower(host) + req.RequestLine.RequestTarget
+}
+
+// lookup returns the most recent stored variant that matches req. varyMiss
+// reports whether the key had variants but none matched.
+func (c *Cache) lookup(key string, req *request.Request) (entry *Entry, varyMiss bool) {
+	variants := c.storage.Get(key)
+	for _, e := range variants {
+		if matchesVary(e, req) && (entry == nil || e.ResponseTime.After(entry.ResponseTime)) {
+			entry = e
+		}
+	}
+	return entry, entry == nil && len(variants) > 0
+}
+
+func matchesVary(e *Entry, req *request.Request) bool {
+	for name, want := range e.Vary {
+		if varyValue(req, name) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// varyValue normalises a request header for Vary matching by collapsing
+// whitespace.
+func varyValue(req *request.Request, name string) string {
+	value, _ := req.Headers.Get(name)
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func varyValues(req *request.Request, h headers.Headers) map[string]string {
+	vary, ok := h.Get("Vary")
+	if !ok {
+		return nil
+	}
+	values := map[string]string{}
+	for _, name := range strings.Split(vary, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			values[name] = varyValue(req, name)
+		}
+	}
+	return values
+}
+
+// store adds e to the variants of key, replacing the one it supersedes.
+func (c *Cache) store(key string, e *Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if at, ok := c.invalidated[key]; ok && e.RequestTime.Before(at) {
+		return
+	}
+	variants := []*Entry{e}
+	for _, old := range c.storage.Get(key) {
+		if !sameVary(old.Vary, e.Vary) {
+			variants = append(variants, old)
+		}
+	}
+	c.storage.Set(key, variants)
+}
+
+// invalidationHorizon is how long an invalidation is remembered; responses
+// still in flight after that may be stored again.
+const invalidationHorizon = time.Minute
+
+// invalidate removes every stored variant of key.
+func (c *Cache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for k, at := range c.invalidated {
+		if now.Sub(at) > invalidationHorizon {
+			delete(c.invalidated, k)
+		}
+	}
+	c.invalidated[key] = now
+	c.storage.Delete(key)
+}
+
+func sameVary(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if other, ok := b[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+func storedHeaders(h headers.Headers) headers.Headers {
+	stored := headers.NewHeaders()
+	for key, value := range h {
+		stored[key] = value
+	}
+	for _, name := range unstoredHeaders {
+		stored.Remove(name)
+	}
+	return stored
+}
+
+func (c *Cache) serve(w *response.Writer, req *request.Request, e *Entry, age time.Duration, status string) {
+	h := w.Header()
+	for key, value := range e.Header {
+		h.Override(key, value)
+	}
+	h.Override("Age", strconv.Itoa(int(age/time.Second)))
+	h.Override("Cache-Status", cacheStatusName+"; "+status)
+	if e.StatusCode == response.StatusCodeSuccess && conditional.Check(w, req) {
+		return
+	}
+	h.Override("Content-Length", strconv.Itoa(len(e.Body)))
+	if err := w.WriteStatusLine(e.StatusCode); err != nil {
+		return
+	}
+	if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+		return
+	}
+	w.Write(e.Body)
+}
+
+// fetch forwards a request the cache cannot answer, streaming the response
+// to the client while capturing it for storage.
+func (c *Cache) fetch(w *response.Writer, req *request.Request, key, status string) {
+	w.Header().Override("Cache-Status", cacheStatusName+"; "+status)
+	if req.RequestLine.Method == "GET" {
+		requestTime := c.now()
+		w.AddInnerBodyFilter(func(statusCode response.StatusCode, h headers.Headers) func(io.Writer) io.WriteCloser {
+			if !storable(req.Headers, statusCode, h, c.shared) {
+				return nil
+			}
+			e := newEntry(req, statusCode, h, requestTime)
+			return c.capture(e, func() {
+				e.ResponseTime = c.now()
+				c.store(key, e)
+			})
+		})
+	}
+	c.next(w, req)
+}
+
+func newEntry(req *request.Request, statusCode response.StatusCode, h headers.Headers, requestTime time.Time) *Entry {
+	return &Entry{
+		StatusCode:  statusCode,
+		Header:      storedHeaders(h),
+		RequestTime: requestTime,
+		Vary:        varyValues(req, h),
+	}
+}
+
+// capture returns a filter stream that copies the body into e, calling done
+// once it is complete unless it grew past maxObjectSize.
+func (c *Cache) capture(e *Entry, done func()) func(io.Writer) io.WriteCloser {
+	return func(dst io.Writer) io.WriteCloser {
+		return &captureWriter{dst: dst, limit: c.maxObjectSize, entry: e, done: done}
+	}
+}
+
+// captureWriter copies the body it passes through into its entry, giving up
+// once the body exceeds limit.
+type captureWriter struct {
+	dst      io.Writer
+	limit    int
+	entry    *Entry
+	tooLarge bool
+	done     func()
+}
+
+func (cw *captureWriter) Write(p []byte) (int, error) {
+	n, err := cw.dst.Write(p)
+	if !cw.tooLarge {
+		if len(cw.entry.Body)+n > cw.limit {
+			cw.tooLarge = true
+			cw.entry.Body = nil
+		} else {
+			cw.entry.Body = append(cw.entry.Body, p[:n]...)
+		}
+	}
+	return n, err
+}
+
+func (cw *captureWriter) Close() error {
+	if !cw.tooLarge {
+		cw.done()
+	}
+	return nil
+}
+
+// revalidate sends a conditional request for stored to next (RFC 9111
+// section 4.3). A 304 refreshes the stored entry; any other response
+// replaces it. It returns the entry to serve, or nil if the response was
+// too large to hold, and the status next answered.
+func (c *Cache) revalidate(key string, req *request.Request, stored *Entry) (*Entry, response.StatusCode, error) {
+	condReq := req.Clone()
+	condReq.RequestLine.Method = "GET"
+	for _, name := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range", "Range"} {
+		condReq.Headers.Remove(name)
+	}
+	if etag, ok := stored.Header.Get("ETag"); ok {
+		condReq.Headers.Override("If-None-Match", etag)
+	}
+	if lastModified, ok := stored.Header.Get("Last-Modified"); ok {
+		condReq.Headers.Override("If-Modified-Since", lastModified)
+	}
+
+	requestTime := c.now()
+	var e *Entry
+	var canStore, complete bool
+	cw := response.NewWriter(io.Discard)
+	cw.AddInnerBodyFilter(func(statusCode response.StatusCode, h headers.Headers) func(io.Writer) io.WriteCloser {
+		e = newEntry(req, statusCode, h, requestTime)
+		canStore = storable(req.Headers, statusCode, h, c.shared)
+		return c.capture(e, func() { complete = true })
+	})
+	c.next(cw, condReq)
+	if err := cw.Finish(); err != nil {
+		return nil, 0, err
+	}
+	if e == nil {
+		return nil, 0, fmt.Errorf("no response from handler")
+	}
+	responseTime := c.now()
+
+	if e.StatusCode == response.StatusCodeNotModified {
+		updated := &Entry{
+			StatusCode:   stored.StatusCode,
+			Header:       storedHeaders(stored.Header),
+			Body:         stored.Body,
+			RequestTime:  requestTime,
+			ResponseTime: responseTime,
+			Vary:         stored.Vary,
+		}
+		for key, value := range e.Header {
+			updated.Header.Override(key, value)
+		}
+		c.store(key, updated)
+		return updated, e.StatusCode, nil
+	}
+
+	if !complete {
+		c.invalidate(key)
+		return nil, e.StatusCode, nil
+	}
+	e.ResponseTime = responseTime
+	if canStore {
+		c.store(key, e)
+	} else {
+		c.invalidate(key)
+	}
+	return e, e.StatusCode, nil
+}
+
+// revalidateInBackground refreshes stored without holding up the client,
+// at most once at a time per key.
+func (c *Cache) revalidateInBackground(key string, req *request.Request, stored *Entry) {
+	c.mu.Lock()
+	if c.revalidating[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[key] = true
+	c.mu.Unlock()
+
+	condReq := req.Clone()
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, key)
+			c.mu.Unlock()
+		}()
+		if _, _, err := c.revalidate(key, condReq, stored); err != nil {
+			log.Printf("cache: background revalidation of %s failed: %v", key, err)
+		}
+	}()
+}
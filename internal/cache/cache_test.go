@@ -0,0 +1,497 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"httpfromtcp/internal/compress"
+	"httpfromtcp/internal/digest"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type origin struct {
+	mu       sync.Mutex
+	calls    int
+	body     string
+	header   headers.Headers
+	lastReq  *request.Request
+	notFound bool
+}
+
+func newOrigin(body string, header map[string]string) *origin {
+	h := headers.NewHeaders()
+	for key, value := range header {
+		h.Set(key, value)
+	}
+	return &origin{body: body, header: h}
+}
+
+func (o *origin) handle(w *response.Writer, req *request.Request) {
+	o.mu.Lock()
+	o.calls++
+	o.lastReq = req
+	body := o.body
+	for key, value := range o.header {
+		w.Header().Override(key, value)
+	}
+	notFound := o.notFound
+	o.mu.Unlock()
+	if notFound {
+		response.Error(w, response.StatusCodeNotFound, "")
+		return
+	}
+	if inm, ok := req.Headers.Get("If-None-Match"); ok {
+		if etag, _ := w.Header().Get("ETag"); etag == inm {
+			w.WriteStatusLine(response.StatusCodeNotModified)
+			w.WriteHeaders(headers.NewHeaders())
+			return
+		}
+	}
+	w.Write([]byte(body))
+}
+
+func (o *origin) callCount() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.calls
+}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+func newTestCache(o *origin, config Config) (*Cache, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	c := New(o.handle, config)
+	c.now = clock.Now
+	return c, clock
+}
+
+func get(t *testing.T, c *Cache, target string, extraHeaders string) (*http.Response, string) {
+	return do(t, c, "GET "+target+" HTTP/1.1\r\nHost: example.com\r\n"+extraHeaders+"\r\n")
+}
+
+func do(t *testing.T, c *Cache, raw string) (*http.Response, string) {
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	c.Handle(w, req)
+	require.NoError(t, w.Finish())
+	resp, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestCacheFreshness(t *testing.T) {
+	o := newOrigin("cached body", map[string]string{"Cache-Control": "max-age=60", "Content-Type": "text/plain"})
+	c, clock := newTestCache(o, Config{})
+
+	// Test: Miss forwards to the origin
+	resp, body := get(t, c, "/a", "")
+	assert.Equal(t, "cached body", body)
+	assert.Equal(t, "httpfromtcp; fwd=uri-miss", resp.Header.Get("Cache-Status"))
+	assert.Equal(t, 1, o.callCount())
+
+	// Test: Fresh hit served from the cache with Age
+	clock.Advance(10 * time.Second)
+	resp, body = get(t, c, "/a", "")
+	assert.Equal(t, "cached body", body)
+	assert.Equal(t, "10", resp.Header.Get("Age"))
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "httpfromtcp; hit; ttl=50", resp.Header.Get("Cache-Status"))
+	assert.Equal(t, int64(len("cached body")), resp.ContentLength)
+	assert.Equal(t, 1, o.callCount())
+
+	// Test: HEAD answered from the stored GET
+	resp, _ = do(t, c, "HEAD /a HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, o.callCount())
+
+	// Test: Other targets are separate entries
+	get(t, c, "/b", "")
+	assert.Equal(t, 2, o.callCount())
+
+	// Test: Stale entry without validators is fetched again
+	clock.Advance(60 * time.Second)
+	resp, _ = get(t, c, "/a", "")
+	assert.Equal(t, "httpfromtcp; fwd=stale", resp.Header.Get("Cache-Status"))
+	assert.Equal(t, 3, o.callCount())
+}
+
+func TestCacheExpiresAndAge(t *testing.T) {
+	clockStart := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	o := newOrigin("x", map[string]string{
+		"Date":    headers.FormatTime(clockStart),
+		"Expires": headers.FormatTime(clockStart.Add(30 * time.Second)),
+		"Age":     "20",
+	})
+	c, clock := newTestCache(o, Config{})
+
+	// Test: Expires relative to Date, with the upstream Age counted
+	get(t, c, "/", "")
+	clock.Advance(5 * time.Second)
+	resp, _ := get(t, c, "/", "")
+	assert.Equal(t, "25", resp.Header.Get("Age"))
+	assert.Equal(t, 1, o.callCount())
+	clock.Advance(6 * time.Second)
+	get(t, c, "/", "")
+	assert.Equal(t, 2, o.callCount())
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	o := newOrigin("v1", map[string]string{"Cache-Control": "max-age=10", "ETag": `"v1"`})
+	c, clock := newTestCache(o, Config{})
+	get(t, c, "/", "")
+
+	// Test: Stale entry revalidated with If-None-Match and refreshed on 304
+	clock.Advance(20 * time.Second)
+	resp, body := get(t, c, "/", "")
+	assert.Equal(t, "v1", body)
+	assert.Equal(t, "httpfromtcp; fwd=stale; fwd-status=304", resp.Header.Get("Cache-Status"))
+	inm, _ := o.lastReq.Headers.Get("If-None-Match")
+	assert.Equal(t, `"v1"`, inm)
+	assert.Equal(t, 2, o.callCount())
+	clock.Advance(5 * time.Second)
+	resp, _ = get(t, c, "/", "")
+	assert.Equal(t, "5", resp.Header.Get("Age"))
+	assert.Equal(t, 2, o.callCount())
+
+	// Test: Headers sent with a 304 update the stored entry
+	o.header.Override("X-Version", "2")
+	clock.Advance(20 * time.Second)
+	resp, body = get(t, c, "/", "")
+	assert.Equal(t, "v1", body)
+	assert.Equal(t, "2", resp.Header.Get("X-Version"))
+	assert.Equal(t, 3, o.callCount())
+
+	// Test: Changed representation replaces the entry
+	o.body = "v2"
+	o.header.Override("ETag", `"v2"`)
+	clock.Advance(20 * time.Second)
+	_, body = get(t, c, "/", "")
+	assert.Equal(t, "v2", body)
+	_, body = get(t, c, "/", "")
+	assert.Equal(t, "v2", body)
+	assert.Equal(t, 4, o.callCount())
+
+	// Test: Client conditional request answered from the cache
+	resp, _ = get(t, c, "/", "If-None-Match: \"v2\"\r\n")
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, 4, o.callCount())
+
+	// Test: Request no-cache forces revalidation
+	resp, _ = get(t, c, "/", "Cache-Control: no-cache\r\n")
+	assert.Equal(t, "httpfromtcp; fwd=stale; fwd-status=304", resp.Header.Get("Cache-Status"))
+	assert.Equal(t, 5, o.callCount())
+}
+
+func TestCacheRevalidationTooLarge(t *testing.T) {
+	o := newOrigin("small", map[string]string{"Cache-Control": "max-age=10", "ETag": `"v1"`})
+	c, clock := newTestCache(o, Config{MaxObjectSize: 50})
+	get(t, c, "/", "")
+
+	// Test: Oversized replacement reaches the client whole and is not stored
+	o.body = strings.Repeat("x", 100)
+	o.header.Override("ETag", `"v2"`)
+	clock.Advance(20 * time.Second)
+	resp, body := get(t, c, "/", "")
+	assert.Equal(t, strings.Repeat("x", 100), body)
+	assert.Equal(t, "httpfromtcp; fwd=stale", resp.Header.Get("Cache-Status"))
+	_, body = get(t, c, "/", "")
+	assert.Len(t, body, 100)
+	assert.Equal(t, 4, o.callCount())
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	o := newOrigin("old", map[string]string{"Cache-Control": "max-age=10, stale-while-revalidate=30", "ETag": `"old"`})
+	c, clock := newTestCache(o, Config{})
+	get(t, c, "/", "")
+
+	// Test: Stale response served immediately while refreshed in the background
+	o.mu.Lock()
+	o.body = "new"
+	o.header.Override("ETag", `"new"`)
+	o.mu.Unlock()
+	clock.Advance(15 * time.Second)
+	resp, body := get(t, c, "/", "")
+	assert.Equal(t, "old", body)
+	assert.Equal(t, "httpfromtcp; hit; ttl=-5", resp.Header.Get("Cache-Status"))
+	require.Eventually(t, func() bool { return o.callCount() == 2 }, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, body := get(t, c, "/", "")
+		return body == "new"
+	}, time.Second, 5*time.Millisecond)
+
+	// Test: Beyond the window the request waits for revalidation
+	clock.Advance(60 * time.Second)
+	resp, _ = get(t, c, "/", "")
+	assert.Equal(t, "httpfromtcp; fwd=stale; fwd-status=304", resp.Header.Get("Cache-Status"))
+}
+
+func TestCacheRequestDirectives(t *testing.T) {
+	o := newOrigin("x", map[string]string{"Cache-Control": "max-age=60", "ETag": `"x"`})
+	c, clock := newTestCache(o, Config{})
+
+	// Test: only-if-cached on a miss gives 504
+	resp, _ := get(t, c, "/", "Cache-Control: only-if-cached\r\n")
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	assert.Equal(t, 0, o.callCount())
+
+	// Test: Request no-store skips storage
+	get(t, c, "/", "Cache-Control: no-store\r\n")
+	get(t, c, "/", "")
+	assert.Equal(t, 2, o.callCount())
+
+	// Test: Request max-age limits the acceptable age
+	clock.Advance(30 * time.Second)
+	get(t, c, "/", "Cache-Control: max-age=10\r\n")
+	assert.Equal(t, 3, o.callCount())
+
+	// Test: max-stale accepts a stale response
+	clock.Advance(90 * time.Second)
+	resp, _ = get(t, c, "/", "Cache-Control: max-stale=60\r\n")
+	assert.Equal(t, "httpfromtcp; hit; ttl=-30", resp.Header.Get("Cache-Status"))
+	assert.Equal(t, 3, o.callCount())
+}
+
+func TestCacheResponseDirectives(t *testing.T) {
+	// Test: no-store and private responses are not stored by a shared cache
+	for _, cc := range []string{"no-store", "private, max-age=60"} {
+		o := newOrigin("x", map[string]string{"Cache-Control": cc})
+		c, _ := newTestCache(o, Config{})
+		get(t, c, "/", "")
+		get(t, c, "/", "")
+		assert.Equal(t, 2, o.callCount(), cc)
+	}
+
+	// Test: private responses are stored by a private cache
+	o := newOrigin("x", map[string]string{"Cache-Control": "private, max-age=60"})
+	c, _ := newTestCache(o, Config{Private: true})
+	get(t, c, "/", "")
+	get(t, c, "/", "")
+	assert.Equal(t, 1, o.callCount())
+
+	// Test: s-maxage overrides max-age in a shared cache
+	o = newOrigin("x", map[string]string{"Cache-Control": "max-age=60, s-maxage=5"})
+	c, clock := newTestCache(o, Config{})
+	get(t, c, "/", "")
+	clock.Advance(10 * time.Second)
+	get(t, c, "/", "")
+	assert.Equal(t, 2, o.callCount())
+
+	// Test: must-revalidate refuses max-stale
+	o = newOrigin("x", map[string]string{"Cache-Control": "max-age=5, must-revalidate"})
+	c, clock = newTestCache(o, Config{})
+	get(t, c, "/", "")
+	clock.Advance(10 * time.Second)
+	get(t, c, "/", "Cache-Control: max-stale\r\n")
+	assert.Equal(t, 2, o.callCount())
+
+	// Test: Authorized requests are only stored when explicitly allowed
+	o = newOrigin("x", map[string]string{"Cache-Control": "max-age=60"})
+	c, _ = newTestCache(o, Config{})
+	get(t, c, "/", "Authorization: Bearer t\r\n")
+	get(t, c, "/", "Authorization: Bearer t\r\n")
+	assert.Equal(t, 2, o.callCount())
+}
+
+func TestCacheVary(t *testing.T) {
+	o := newOrigin("x", map[string]string{"Cache-Control": "max-age=60", "Vary": "Accept-Language"})
+	c, _ := newTestCache(o, Config{})
+
+	// Test: Each header value is stored as its own variant
+	get(t, c, "/", "Accept-Language: en\r\n")
+	get(t, c, "/", "Accept-Language: de\r\n")
+	assert.Equal(t, 2, o.callCount())
+	resp, _ := get(t, c, "/", "Accept-Language:  en\r\n")
+	assert.Equal(t, 2, o.callCount())
+	assert.Equal(t, "httpfromtcp; hit; ttl=60", resp.Header.Get("Cache-Status"))
+
+	// Test: Unmatched value is a vary miss
+	resp, _ = get(t, c, "/", "Accept-Language: fr\r\n")
+	assert.Equal(t, "httpfromtcp; fwd=vary-miss", resp.Header.Get("Cache-Status"))
+
+	// Test: Vary: * is never stored
+	o = newOrigin("x", map[string]string{"Cache-Control": "max-age=60", "Vary": "*"})
+	c, _ = newTestCache(o, Config{})
+	get(t, c, "/", "")
+	get(t, c, "/", "")
+	assert.Equal(t, 2, o.callCount())
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	o := newOrigin("x", map[string]string{"Cache-Control": "max-age=60"})
+	c, _ := newTestCache(o, Config{})
+	get(t, c, "/item", "")
+
+	// Test: Unsafe method invalidates the stored response
+	do(t, c, "POST /item HTTP/1.1\r\nHost: example.com\r\nContent-Length: 1\r\n\r\nx")
+	get(t, c, "/item", "")
+	assert.Equal(t, 3, o.callCount())
+
+	// Test: Error response to an unsafe method leaves the entry alone
+	o.mu.Lock()
+	o.notFound = true
+	o.mu.Unlock()
+	do(t, c, "POST /item HTTP/1.1\r\nHost: example.com\r\nContent-Length: 1\r\n\r\nx")
+	o.mu.Lock()
+	o.notFound = false
+	o.mu.Unlock()
+	resp, _ := get(t, c, "/item", "")
+	assert.Equal(t, "httpfromtcp; hit; ttl=60", resp.Header.Get("Cache-Status"))
+	assert.Equal(t, 4, o.callCount())
+}
+
+func TestCacheInvalidationDuringFetch(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.Method == "DELETE" {
+			w.WriteStatusLine(response.StatusCodeNoContent)
+			w.WriteHeaders(headers.NewHeaders())
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("old"))
+		close(started)
+		<-release
+	}
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	c := New(handler, Config{})
+	c.now = clock.Now
+
+	// Test: Response requested before an invalidation is not stored after it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		get(t, c, "/item", "")
+	}()
+	<-started
+	clock.Advance(time.Second)
+	resp, _ := do(t, c, "DELETE /item HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	close(release)
+	<-done
+	assert.Empty(t, c.storage.Get("example.com/item"))
+}
+
+func TestCacheMaxObjectSize(t *testing.T) {
+	o := newOrigin(strings.Repeat("x", 100), map[string]string{"Cache-Control": "max-age=60"})
+	c, _ := newTestCache(o, Config{MaxObjectSize: 50})
+
+	// Test: Oversized body streamed but not stored
+	_, body := get(t, c, "/", "")
+	assert.Len(t, body, 100)
+	get(t, c, "/", "")
+	assert.Equal(t, 2, o.callCount())
+}
+
+func TestCacheBehindCompression(t *testing.T) {
+	page := strings.Repeat("<p>cache me</p>\n", 100)
+	o := newOrigin(page, map[string]string{"Cache-Control": "max-age=10", "Content-Type": "text/html", "ETag": `"v1"`})
+	c, clock := newTestCache(o, Config{})
+	handler := compress.Middleware(c.Handle, compress.Config{MinSize: 16})
+	serve := func(acceptEncoding string) (*http.Response, string) {
+		req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: x\r\nAccept-Encoding: " + acceptEncoding + "\r\n\r\n"))
+		require.NoError(t, err)
+		buf := &bytes.Buffer{}
+		w := response.NewWriter(buf)
+		handler(w, req)
+		require.NoError(t, w.Finish())
+		resp, err := http.ReadResponse(bufio.NewReader(buf), nil)
+		require.NoError(t, err)
+		var body io.Reader = resp.Body
+		if resp.Header.Get("Content-Encoding") == "gzip" {
+			body, err = gzip.NewReader(resp.Body)
+			require.NoError(t, err)
+		}
+		decoded, err := io.ReadAll(body)
+		require.NoError(t, err)
+		return resp, string(decoded)
+	}
+	assertVariant := func(resp *http.Response, body, encoding, etag string) {
+		assert.Equal(t, encoding, resp.Header.Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+		assert.Equal(t, etag, resp.Header.Get("ETag"))
+		assert.Equal(t, page, body)
+	}
+
+	// Test: Identity representation stored and re-encoded per client on hits
+	resp, body := serve("gzip")
+	assertVariant(resp, body, "gzip", `W/"v1"`)
+	resp, body = serve("gzip")
+	assertVariant(resp, body, "gzip", `W/"v1"`)
+	resp, body = serve("identity")
+	assertVariant(resp, body, "", `"v1"`)
+	assert.Equal(t, 1, o.callCount())
+
+	// Test: Entry refreshed by a 304 keeps serving both encodings
+	clock.Advance(20 * time.Second)
+	resp, body = serve("gzip")
+	assert.Equal(t, "httpfromtcp; fwd=stale; fwd-status=304", resp.Header.Get("Cache-Status"))
+	assertVariant(resp, body, "gzip", `W/"v1"`)
+	resp, body = serve("identity")
+	assertVariant(resp, body, "", `"v1"`)
+	assert.Equal(t, 2, o.callCount())
+
+	// Test: Entry replaced by a 200 on revalidation stays encodable
+	o.header.Override("ETag", `"v2"`)
+	clock.Advance(20 * time.Second)
+	resp, body = serve("identity")
+	assertVariant(resp, body, "", `"v2"`)
+	resp, body = serve("gzip")
+	assertVariant(resp, body, "gzip", `W/"v2"`)
+	assert.Equal(t, 3, o.callCount())
+}
+
+func TestCacheBehindDigest(t *testing.T) {
+	o := newOrigin("digest me", map[string]string{"Cache-Control": "max-age=60"})
+	c, _ := newTestCache(o, Config{})
+	handler := digest.Middleware(c.Handle, digest.Config{Algorithms: []string{"sha-256"}, ContentDigest: true})
+	serve := func() *http.Response {
+		req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+		require.NoError(t, err)
+		buf := &bytes.Buffer{}
+		w := response.NewWriter(buf)
+		handler(w, req)
+		require.NoError(t, w.Finish())
+		resp, err := http.ReadResponse(bufio.NewReader(buf), nil)
+		require.NoError(t, err)
+		return resp
+	}
+
+	// Test: Hits carry the same Content-Digest as the miss
+	miss := serve()
+	hit := serve()
+	assert.Equal(t, 1, o.callCount())
+	assert.Contains(t, hit.Header.Get("Cache-Status"), "hit")
+	assert.NotEmpty(t, miss.Header.Get("Content-Digest"))
+	assert.Equal(t, miss.Header.Get("Content-Digest"), hit.Header.Get("Content-Digest"))
+}
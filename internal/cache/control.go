@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/response"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// directives holds parsed Cache-Control directives keyed by lowercase name.
+type directives map[string]string
+
+func parseCacheControl(h headers.Headers) directives {
+	d := directives{}
+	value, ok := h.Get("Cache-Control")
+	if !ok {
+		return d
+	}
+	for _, item := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(item), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		d[name] = strings.Trim(strings.TrimSpace(arg), "\"")
+	}
+	return d
+}
+
+func (d directives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// seconds returns a delta-seconds argument. A present but invalid value reads
+// as 0, which errs on the side of treating responses as stale.
+func (d directives) seconds(name string) (time.Duration, bool) {
+	arg, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || n < 0 {
+		return 0, true
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// heuristicStatus lists the statuses that may be cached without explicit
+// freshness information (RFC 9110 section 15.1).
+var heuristicStatus = map[response.StatusCode]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// maxHeuristicLifetime caps the 10% of Last-Modified age used when a
+// response carries no explicit freshness.
+const maxHeuristicLifetime = 24 * time.Hour
+
+// date is the origin's Date, or the time the response was received.
+func (e *Entry) date() time.Time {
+	if v, ok := e.Header.Get("Date"); ok {
+		if t, err := headers.ParseTime(v); err == nil {
+			return t
+		}
+	}
+	return e.ResponseTime
+}
+
+// freshnessLifetime implements RFC 9111 section 4.2.1.
+func (e *Entry) freshnessLifetime(shared bool) time.Duration {
+	cc := parseCacheControl(e.Header)
+	if shared {
+		if d, ok := cc.seconds("s-maxage"); ok {
+			return d
+		}
+	}
+	if d, ok := cc.seconds("max-age"); ok {
+		return d
+	}
+	if v, ok := e.Header.Get("Expires"); ok {
+		t, err := headers.ParseTime(v)
+		if err != nil {
+			return 0
+		}
+		return t.Sub(e.date())
+	}
+	if v, ok := e.Header.Get("Last-Modified"); ok && heuristicStatus[e.StatusCode] {
+		if t, err := headers.ParseTime(v); err == nil {
+			return min(e.date().Sub(t)/10, maxHeuristicLifetime)
+		}
+	}
+	return 0
+}
+
+// age implements RFC 9111 section 4.2.3.
+func (e *Entry) age(now time.Time) time.Duration {
+	apparentAge := max(e.ResponseTime.Sub(e.date()), 0)
+	var ageValue time.Duration
+	if v, ok := e.Header.Get("Age"); ok {
+		if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil && n > 0 {
+			ageValue = time.Duration(n) * time.Second
+		}
+	}
+	responseDelay := e.ResponseTime.Sub(e.RequestTime)
+	correctedInitialAge := max(apparentAge, ageValue+responseDelay)
+	return correctedInitialAge + now.Sub(e.ResponseTime)
+}
+
+// storable implements RFC 9111 section 3 for a response to a GET request.
+func storable(reqHeaders headers.Headers, statusCode response.StatusCode, h headers.Headers, shared bool) bool {
+	if statusCode == response.StatusCodePartialContent || statusCode == response.StatusCodeNotModified || statusCode.IsInformational() {
+		return false
+	}
+	reqCC := parseCacheControl(reqHeaders)
+	cc := parseCacheControl(h)
+	if reqCC.has("no-store") || cc.has("no-store") {
+		return false
+	}
+	if shared && cc.has("private") {
+		return false
+	}
+	if _, ok := reqHeaders.Get("Authorization"); ok && shared &&
+		!cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+		return false
+	}
+	if h.HasToken("Vary", "*") {
+		return false
+	}
+	if _, ok := h.Get("Trailer"); ok {
+		return false
+	}
+	_, hasExpires := h.Get("Expires")
+	if hasExpires || cc.has("max-age") || (shared && cc.has("s-maxage")) || cc.has("public") {
+		return true
+	}
+	// without explicit freshness an entry is only useful if it can get a
+	// heuristic lifetime or be revalidated
+	_, hasETag := h.Get("ETag")
+	_, hasLastModified := h.Get("Last-Modified")
+	return heuristicStatus[statusCode] && (hasETag || hasLastModified)
+}
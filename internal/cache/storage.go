@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"container/list"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/response"
+	"sync"
+	"time"
+)
+
+// Entry is a stored response. Entries are never modified once stored, so
+// they can be served while a newer one replaces them.
+type Entry struct {
+	StatusCode response.StatusCode
+	Header     headers.Headers
+	Body       []byte
+	// RequestTime and ResponseTime bracket the request that produced the
+	// entry, for the age calculation in RFC 9111 section 4.2.3.
+	RequestTime  time.Time
+	ResponseTime time.Time
+	// Vary records the request's values of the headers named by Vary.
+	Vary map[string]string
+}
+
+func (e *Entry) Size() int {
+	size := len(e.Body)
+	for key, value := range e.Header {
+		size += len(key) + len(value)
+	}
+	for key, value := range e.Vary {
+		size += len(key) + len(value)
+	}
+	return size
+}
+
+// Storage holds the variants stored for each cache key. Implementations must
+// be safe for concurrent use and may drop entries at any time.
+type Storage interface {
+	Get(key string) []*Entry
+	Set(key string, variants []*Entry)
+	Delete(key string)
+}
+
+// MemoryStorage keeps entries in memory, evicting the least recently used
+// keys once their total size exceeds the limit.
+type MemoryStorage struct {
+	mu       sync.Mutex
+	maxBytes int
+	size     int
+	lru      *list.List
+	items    map[string]*list.Element
+}
+
+type memoryItem struct {
+	key      string
+	variants []*Entry
+	size     int
+}
+
+func NewMemoryStorage(maxBytes int) *MemoryStorage {
+	return &MemoryStorage{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func (s *MemoryStorage) Get(key string) []*Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	s.lru.MoveToFront(el)
+	return el.Value.(*memoryItem).variants
+}
+
+func (s *MemoryStorage) Set(key string, variants []*Entry) {
+	item := &memoryItem{key: key, variants: variants}
+	for _, e := range variants {
+		item.size += e.Size()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+	if item.size > s.maxBytes {
+		return
+	}
+	s.items[key] = s.lru.PushFront(item)
+	s.size += item.size
+	for s.size > s.maxBytes {
+		s.remove(s.lru.Back().Value.(*memoryItem).key)
+	}
+}
+
+func (s *MemoryStorage) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+}
+
+// Size returns the total size of the stored entries.
+func (s *MemoryStorage) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+func (s *MemoryStorage) remove(key string) {
+	el, ok := s.items[key]
+	if !ok {
+		return
+	}
+	s.lru.Remove(el)
+	delete(s.items, key)
+	s.size -= el.Value.(*memoryItem).size
+}
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"httpfromtcp/internal/headers"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func entryOfSize(n int) *Entry {
+	return &Entry{Header: headers.NewHeaders(), Body: make([]byte, n)}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	s := NewMemoryStorage(100)
+
+	// Test: Stored variants returned
+	s.Set("a", []*Entry{entryOfSize(40)})
+	assert.Len(t, s.Get("a"), 1)
+	assert.Equal(t, 40, s.Size())
+
+	// Test: Least recently used key evicted first
+	s.Set("b", []*Entry{entryOfSize(40)})
+	s.Get("a")
+	s.Set("c", []*Entry{entryOfSize(40)})
+	assert.NotNil(t, s.Get("a"))
+	assert.Nil(t, s.Get("b"))
+	assert.NotNil(t, s.Get("c"))
+	assert.Equal(t, 80, s.Size())
+
+	// Test: Replacing a key updates its size
+	s.Set("a", []*Entry{entryOfSize(10), entryOfSize(10)})
+	assert.Equal(t, 60, s.Size())
+
+	// Test: Entry larger than the whole storage is not kept
+	s.Set("d", []*Entry{entryOfSize(200)})
+	assert.Nil(t, s.Get("d"))
+	assert.Equal(t, 60, s.Size())
+
+	// Test: Delete
+	s.Delete("c")
+	assert.Nil(t, s.Get("c"))
+	assert.Equal(t, 20, s.Size())
+}
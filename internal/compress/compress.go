@@ -0,0 +1,158 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Config struct {
+	// MinSize skips responses whose Content-Length is smaller, whether the
+	// handler declared it or the writer buffered the whole body.
+	MinSize int
+	// Level is passed to the gzip and zlib writers; 0 means the default level.
+	Level int
+	// ContentTypes lists compressible media types; a trailing "/" matches a
+	// whole top-level type. Empty means DefaultContentTypes.
+	ContentTypes []string
+}
+
+var DefaultConfig = Config{
+	MinSize: 1024,
+	Level:   gzip.DefaultCompression,
+}
+
+var DefaultContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// Middleware compresses responses from next with gzip or deflate, whichever
+// the client's Accept-Encoding prefers.
+func Middleware(next server.Handler, config Config) server.Handler {
+	if config.Level == 0 {
+		config.Level = gzip.DefaultCompression
+	}
+	if len(config.ContentTypes) == 0 {
+		config.ContentTypes = DefaultContentTypes
+	}
+	return func(w *response.Writer, req *request.Request) {
+		acceptEncoding, _ := req.Headers.Get("Accept-Encoding")
+		w.AddBodyFilter(config.filter(Negotiate(acceptEncoding)))
+		next(w, req)
+	}
+}
+
+func (c Config) filter(encoding string) response.BodyFilter {
+	return func(statusCode response.StatusCode, h headers.Headers) func(io.Writer) io.WriteCloser {
+		if statusCode.HasNoBody() || statusCode == response.StatusCodePartialContent || h.HasToken("Cache-Control", "no-transform") {
+			return nil
+		}
+		if _, ok := h.Get("Content-Encoding"); ok {
+			return nil
+		}
+		contentType, _ := h.Get("Content-Type")
+		if !c.compressible(contentType) {
+			return nil
+		}
+		if !h.HasToken("Vary", "Accept-Encoding") {
+			h.Set("Vary", "Accept-Encoding")
+		}
+		if encoding == "" {
+			return nil
+		}
+		if v, ok := h.Get("Content-Length"); ok {
+			if n, err := strconv.Atoi(v); err == nil && n < c.MinSize {
+				return nil
+			}
+		}
+
+		h.Override("Content-Encoding", encoding)
+		h.Remove("Content-Length")
+		h.Remove("Accept-Ranges")
+		h.Override("Transfer-Encoding", "chunked")
+		if etag, ok := h.Get("ETag"); ok && !strings.HasPrefix(etag, "W/") {
+			// the encoded bytes differ from the identity representation
+			h.Override("ETag", "W/"+etag)
+		}
+		return func(dst io.Writer) io.WriteCloser {
+			if encoding == "gzip" {
+				zw, _ := gzip.NewWriterLevel(dst, c.Level)
+				return zw
+			}
+			zw, _ := zlib.NewWriterLevel(dst, c.Level)
+			return zw
+		}
+	}
+}
+
+func (c Config) compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		return false
+	}
+	for _, t := range c.ContentTypes {
+		if strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) || mediaType == t {
+			return true
+		}
+	}
+	return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// Negotiate picks "gzip", "deflate" or "" (identity) from an Accept-Encoding
+// value using its q-values (RFC 9110 section 12.5.3). gzip wins ties.
+func Negotiate(acceptEncoding string) string {
+	weights := map[string]float64{}
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(item, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+		weights[coding] = parseQValue(params)
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range []string{"gzip", "deflate"} {
+		q, ok := weights[coding]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+func parseQValue(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "q") {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || q < 0 {
+			return 0
+		}
+		if q > 1 {
+			return 1
+		}
+		return q
+	}
+	return 1
+}
@@ -0,0 +1,132 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	// Test: No header means identity
+	assert.Equal(t, "", Negotiate(""))
+
+	// Test: Plain list prefers gzip
+	assert.Equal(t, "gzip", Negotiate("deflate, gzip"))
+
+	// Test: q-values decide
+	assert.Equal(t, "deflate", Negotiate("gzip;q=0.5, deflate;q=0.8"))
+
+	// Test: Explicit refusal
+	assert.Equal(t, "deflate", Negotiate("gzip;q=0, *"))
+
+	// Test: Only identity acceptable
+	assert.Equal(t, "", Negotiate("identity, *;q=0"))
+
+	// Test: Unsupported codings only
+	assert.Equal(t, "", Negotiate("br, zstd"))
+}
+
+func serveCompressed(t *testing.T, acceptEncoding string, handler func(w *response.Writer, req *request.Request)) *http.Response {
+	raw := "GET / HTTP/1.1\r\nHost: x\r\n"
+	if acceptEncoding != "" {
+		raw += "Accept-Encoding: " + acceptEncoding + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	Middleware(handler, Config{MinSize: 16})(w, req)
+	require.NoError(t, w.Finish())
+	resp, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	return resp
+}
+
+var page = strings.Repeat("<p>hello compressible world</p>\n", 50)
+
+func pageHandler(w *response.Writer, _ *request.Request) {
+	w.WriteStatusLine(response.StatusCodeSuccess)
+	h := response.GetDefaultHeaders(len(page))
+	h.Override("Content-Type", "text/html")
+	h.Set("ETag", `"v1"`)
+	w.WriteHeaders(h)
+	w.WriteBody([]byte(page))
+}
+
+func TestMiddleware(t *testing.T) {
+	// Test: gzip response replaces Content-Length with chunked encoding
+	resp := serveCompressed(t, "gzip", pageHandler)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Equal(t, `W/"v1"`, resp.Header.Get("ETag"))
+	zr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, page, string(body))
+
+	// Test: deflate response
+	resp = serveCompressed(t, "deflate", pageHandler)
+	assert.Equal(t, "deflate", resp.Header.Get("Content-Encoding"))
+	zr2, err := zlib.NewReader(resp.Body)
+	require.NoError(t, err)
+	body, err = io.ReadAll(zr2)
+	require.NoError(t, err)
+	assert.Equal(t, page, string(body))
+
+	// Test: Identity when not accepted still varies
+	resp = serveCompressed(t, "", pageHandler)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, page, string(body))
+
+	// Test: Small bodies are left alone
+	resp = serveCompressed(t, "gzip", func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		w.WriteHeaders(response.GetDefaultHeaders(2))
+		w.WriteBody([]byte("ok"))
+	})
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, int64(2), resp.ContentLength)
+
+	// Test: Small buffered bodies without a declared length are left alone
+	resp = serveCompressed(t, "gzip", func(w *response.Writer, _ *request.Request) {
+		w.Write([]byte("<p>hi</p>"))
+	})
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, int64(len("<p>hi</p>")), resp.ContentLength)
+
+	// Test: Incompressible content type
+	resp = serveCompressed(t, "gzip", func(w *response.Writer, _ *request.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write([]byte(page))
+	})
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+
+	// Test: Streaming writes with sniffed type
+	resp = serveCompressed(t, "gzip", func(w *response.Writer, _ *request.Request) {
+		w.Write([]byte(page))
+		w.Flush()
+		w.Write([]byte(page))
+	})
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	zr, err = gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	body, err = io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, page+page, string(body))
+}
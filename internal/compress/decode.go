@@ -0,0 +1,100 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnsupportedEncoding = errors.New("unsupported content-coding")
+	ErrDecodedTooLarge     = errors.New("decoded body too large")
+)
+
+type DecodeConfig struct {
+	// MaxDecodedSize bounds the decompressed body to stop zip bombs.
+	MaxDecodedSize int64
+}
+
+var DefaultDecodeConfig = DecodeConfig{
+	MaxDecodedSize: 10 << 20,
+}
+
+// DecodeRequests transparently decodes gzip and deflate request bodies before
+// calling next, which then sees the identity body without Content-Encoding.
+func DecodeRequests(next server.Handler, config DecodeConfig) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		if _, ok := req.Headers.Get("Content-Encoding"); !ok {
+			next(w, req)
+			return
+		}
+		body, err := req.ReadBody()
+		if err != nil {
+			response.Error(w, response.StatusCodeBadRequest, err.Error())
+			return
+		}
+		encoding, _ := req.Headers.Get("Content-Encoding")
+		decoded, err := Decode(body, encoding, config.MaxDecodedSize)
+		switch {
+		case errors.Is(err, ErrUnsupportedEncoding):
+			w.Header().Set("Accept-Encoding", "gzip, deflate")
+			response.Error(w, response.StatusCodeUnsupportedMediaType, err.Error())
+			return
+		case errors.Is(err, ErrDecodedTooLarge):
+			response.Error(w, response.StatusCodeContentTooLarge, err.Error())
+			return
+		case err != nil:
+			response.Error(w, response.StatusCodeBadRequest, err.Error())
+			return
+		}
+		req.Body = decoded
+		req.Headers.Remove("Content-Encoding")
+		// the digest covered the encoded bytes
+		req.Headers.Remove("Content-Digest")
+		req.Headers.Override("Content-Length", strconv.Itoa(len(decoded)))
+		next(w, req)
+	}
+}
+
+// Decode reverses the codings listed in a Content-Encoding value, last
+// applied first. maxSize <= 0 disables the size limit.
+func Decode(body []byte, contentEncoding string, maxSize int64) ([]byte, error) {
+	codings := strings.Split(contentEncoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		var r io.Reader
+		var err error
+		switch coding {
+		case "identity", "":
+			continue
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(bytes.NewReader(body))
+		case "deflate":
+			r, err = zlib.NewReader(bytes.NewReader(body))
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, coding)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s body: %w", coding, err)
+		}
+		if maxSize > 0 {
+			r = io.LimitReader(r, maxSize+1)
+		}
+		body, err = io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s body: %w", coding, err)
+		}
+		if maxSize > 0 && int64(len(body)) > maxSize {
+			return nil, fmt.Errorf("%w: limit is %d bytes", ErrDecodedTooLarge, maxSize)
+		}
+	}
+	return body, nil
+}
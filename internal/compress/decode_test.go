@@ -0,0 +1,94 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func deflateBytes(t *testing.T, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	payload := []byte(`{"agent":"a1","events":[1,2,3]}`)
+
+	// Test: gzip body
+	decoded, err := Decode(gzipBytes(t, payload), "gzip", 0)
+	require.NoError(t, err)
+	assert.Equal(t, payload, decoded)
+
+	// Test: Stacked codings are removed last first
+	decoded, err = Decode(gzipBytes(t, deflateBytes(t, payload)), "deflate, gzip", 0)
+	require.NoError(t, err)
+	assert.Equal(t, payload, decoded)
+
+	// Test: Unknown coding
+	_, err = Decode(payload, "br", 0)
+	require.ErrorIs(t, err, ErrUnsupportedEncoding)
+
+	// Test: Decompressed size limit
+	bomb := gzipBytes(t, bytes.Repeat([]byte{0}, 1<<20))
+	_, err = Decode(bomb, "gzip", 1024)
+	require.ErrorIs(t, err, ErrDecodedTooLarge)
+
+	// Test: Corrupt body
+	_, err = Decode([]byte("not gzip"), "gzip", 0)
+	require.Error(t, err)
+}
+
+func serveDecoded(t *testing.T, contentEncoding string, body []byte) (string, string) {
+	raw := "POST /ingest HTTP/1.1\r\nHost: x\r\nContent-Encoding: " + contentEncoding +
+		"\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + string(body)
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	seen := ""
+	DecodeRequests(func(w *response.Writer, req *request.Request) {
+		_, hasEncoding := req.Headers.Get("Content-Encoding")
+		assert.False(t, hasEncoding)
+		seen = string(req.Body)
+	}, DecodeConfig{MaxDecodedSize: 1024})(w, req)
+	require.NoError(t, w.Finish())
+	return buf.String(), seen
+}
+
+func TestDecodeRequests(t *testing.T) {
+	// Test: Handler sees decoded body
+	resp, seen := serveDecoded(t, "gzip", gzipBytes(t, []byte("hello")))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Equal(t, "hello", seen)
+
+	// Test: Unknown coding gives 415
+	resp, seen = serveDecoded(t, "br", []byte("hello"))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 415 Unsupported Media Type\r\n"))
+	assert.Contains(t, resp, "accept-encoding: gzip, deflate\r\n")
+	assert.Equal(t, "", seen)
+
+	// Test: Zip bomb gives 413
+	resp, _ = serveDecoded(t, "gzip", gzipBytes(t, bytes.Repeat([]byte{0}, 1<<16)))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 413 Content Too Large\r\n"))
+}
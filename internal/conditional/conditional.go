@@ -0,0 +1,121 @@
+package conditional
+
+import (
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"strings"
+	"time"
+)
+
+type Result int
+
+const (
+	Proceed Result = iota
+	NotModified
+	PreconditionFailed
+)
+
+// Evaluate applies the request preconditions in the order given by RFC 9110
+// section 13.2.2 to a representation with the given validators. An empty etag
+// or zero lastModified means the representation has no such validator.
+func Evaluate(req *request.Request, etag string, lastModified time.Time) Result {
+	h := req.Headers
+	method := req.RequestLine.Method
+	lastModified = lastModified.Truncate(time.Second)
+
+	if ifMatch, ok := h.Get("If-Match"); ok {
+		if !matchETag(ifMatch, etag, strongCompare) {
+			return PreconditionFailed
+		}
+	} else if ifUnmodifiedSince, ok := h.Get("If-Unmodified-Since"); ok && !lastModified.IsZero() {
+		if t, err := headers.ParseTime(ifUnmodifiedSince); err == nil && lastModified.After(t) {
+			return PreconditionFailed
+		}
+	}
+
+	if ifNoneMatch, ok := h.Get("If-None-Match"); ok {
+		if matchETag(ifNoneMatch, etag, weakCompare) {
+			if method == "GET" || method == "HEAD" {
+				return NotModified
+			}
+			return PreconditionFailed
+		}
+	} else if ifModifiedSince, ok := h.Get("If-Modified-Since"); ok && (method == "GET" || method == "HEAD") && !lastModified.IsZero() {
+		if t, err := headers.ParseTime(ifModifiedSince); err == nil && !lastModified.After(t) {
+			return NotModified
+		}
+	}
+	return Proceed
+}
+
+// IfRange reports whether a Range header should be honoured. Only a strong
+// ETag match or an exact Last-Modified date satisfies If-Range.
+func IfRange(req *request.Request, etag string, lastModified time.Time) bool {
+	ifRange, ok := req.Headers.Get("If-Range")
+	if !ok {
+		return true
+	}
+	if strings.HasPrefix(ifRange, "\"") || strings.HasPrefix(ifRange, "W/") {
+		return etag != "" && strongCompare(ifRange, etag)
+	}
+	t, err := headers.ParseTime(ifRange)
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+	return t.Equal(lastModified.Truncate(time.Second))
+}
+
+// Check evaluates the request against the ETag and Last-Modified headers the
+// handler has already set on w. If a precondition decides the outcome it
+// writes the 304 or 412 response and returns true.
+func Check(w *response.Writer, req *request.Request) bool {
+	etag, _ := w.Header().Get("ETag")
+	var lastModified time.Time
+	if v, ok := w.Header().Get("Last-Modified"); ok {
+		lastModified, _ = headers.ParseTime(v)
+	}
+	switch Evaluate(req, etag, lastModified) {
+	case NotModified:
+		h := w.Header()
+		h.Remove("Content-Type")
+		h.Remove("Content-Length")
+		if err := w.WriteStatusLine(response.StatusCodeNotModified); err == nil {
+			w.WriteHeaders(headers.NewHeaders())
+		}
+		return true
+	case PreconditionFailed:
+		response.Error(w, response.StatusCodePreconditionFailed, "")
+		return true
+	}
+	return false
+}
+
+// matchETag reports whether the If-Match/If-None-Match list matches etag.
+func matchETag(list, etag string, compare func(a, b string) bool) bool {
+	list = strings.TrimSpace(list)
+	if list == "*" {
+		return etag != ""
+	}
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		if compare(strings.TrimSpace(candidate), etag) {
+			return true
+		}
+	}
+	return false
+}
+
+func strongCompare(a, b string) bool {
+	return !isWeak(a) && !isWeak(b) && a == b
+}
+
+func weakCompare(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+func isWeak(etag string) bool {
+	return strings.HasPrefix(etag, "W/")
+}
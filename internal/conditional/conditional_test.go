@@ -0,0 +1,90 @@
+package conditional
+
+import (
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var modified = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newRequest(t *testing.T, method, extraHeaders string) *request.Request {
+	req, err := request.RequestFromReader(strings.NewReader(method + " / HTTP/1.1\r\nHost: x\r\n" + extraHeaders + "\r\n"))
+	require.NoError(t, err)
+	return req
+}
+
+func TestEvaluate(t *testing.T) {
+	// Test: No preconditions
+	assert.Equal(t, Proceed, Evaluate(newRequest(t, "GET", ""), `"a"`, modified))
+
+	// Test: If-None-Match weak match on GET
+	assert.Equal(t, NotModified, Evaluate(newRequest(t, "GET", "If-None-Match: \"x\", W/\"a\"\r\n"), `"a"`, modified))
+
+	// Test: If-None-Match match on unsafe method
+	assert.Equal(t, PreconditionFailed, Evaluate(newRequest(t, "PUT", "If-None-Match: *\r\n"), `"a"`, modified))
+
+	// Test: If-None-Match mismatch
+	assert.Equal(t, Proceed, Evaluate(newRequest(t, "GET", "If-None-Match: \"b\"\r\n"), `"a"`, modified))
+
+	// Test: If-Match requires strong comparison
+	assert.Equal(t, PreconditionFailed, Evaluate(newRequest(t, "PUT", "If-Match: W/\"a\"\r\n"), `"a"`, modified))
+	assert.Equal(t, Proceed, Evaluate(newRequest(t, "PUT", "If-Match: \"a\"\r\n"), `"a"`, modified))
+
+	// Test: If-Modified-Since not modified
+	assert.Equal(t, NotModified, Evaluate(newRequest(t, "GET", "If-Modified-Since: Tue, 02 Jan 2024 03:04:05 GMT\r\n"), "", modified.Add(500*time.Millisecond)))
+
+	// Test: If-Modified-Since modified
+	assert.Equal(t, Proceed, Evaluate(newRequest(t, "GET", "If-Modified-Since: Mon, 01 Jan 2024 00:00:00 GMT\r\n"), "", modified))
+
+	// Test: If-None-Match takes precedence over If-Modified-Since
+	assert.Equal(t, Proceed, Evaluate(newRequest(t, "GET", "If-None-Match: \"b\"\r\nIf-Modified-Since: Tue, 02 Jan 2024 03:04:05 GMT\r\n"), `"a"`, modified))
+
+	// Test: If-Unmodified-Since modified
+	assert.Equal(t, PreconditionFailed, Evaluate(newRequest(t, "DELETE", "If-Unmodified-Since: Mon, 01 Jan 2024 00:00:00 GMT\r\n"), "", modified))
+
+	// Test: If-Match takes precedence over If-Unmodified-Since
+	assert.Equal(t, Proceed, Evaluate(newRequest(t, "DELETE", "If-Match: \"a\"\r\nIf-Unmodified-Since: Mon, 01 Jan 2024 00:00:00 GMT\r\n"), `"a"`, modified))
+}
+
+func TestCheck(t *testing.T) {
+	// Test: 304 keeps validators and drops the body
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	w.Header().Set("ETag", `"a"`)
+	w.Header().Set("Content-Type", "text/plain")
+	assert.True(t, Check(w, newRequest(t, "GET", "If-None-Match: \"a\"\r\n")))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\netag: \"a\"\r\n\r\n", buf.String())
+	assert.True(t, w.Reusable())
+
+	// Test: 412 on failed If-Match
+	buf = &bytes.Buffer{}
+	w = response.NewWriter(buf)
+	w.Header().Set("ETag", `"a"`)
+	assert.True(t, Check(w, newRequest(t, "PUT", "If-Match: \"b\"\r\n")))
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 412 Precondition Failed\r\n"))
+
+	// Test: No decision leaves the response unwritten
+	buf = &bytes.Buffer{}
+	w = response.NewWriter(buf)
+	assert.False(t, Check(w, newRequest(t, "GET", "If-None-Match: \"a\"\r\n")))
+	assert.Equal(t, "", buf.String())
+}
+
+func TestIfRange(t *testing.T) {
+	// Test: Strong ETag match
+	assert.True(t, IfRange(newRequest(t, "GET", "If-Range: \"a\"\r\n"), `"a"`, modified))
+
+	// Test: Weak ETag never matches
+	assert.False(t, IfRange(newRequest(t, "GET", "If-Range: W/\"a\"\r\n"), `W/"a"`, modified))
+
+	// Test: Exact date match
+	assert.True(t, IfRange(newRequest(t, "GET", "If-Range: Tue, 02 Jan 2024 03:04:05 GMT\r\n"), "", modified))
+}
@@ -0,0 +1,223 @@
+package digest
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Algorithms maps RFC 9530 algorithm keys to their hash constructors.
+var Algorithms = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+type Config struct {
+	// Algorithms lists the algorithm keys to send; empty means sha-256.
+	Algorithms    []string
+	ContentDigest bool
+	// ReprDigest is skipped for 206 responses, where the body is only part of
+	// the representation.
+	ReprDigest bool
+}
+
+var DefaultConfig = Config{
+	Algorithms:    []string{"sha-256"},
+	ContentDigest: true,
+}
+
+// Middleware adds Content-Digest and/or Repr-Digest to the responses of next,
+// hashing the body as it is written. A request's Want-Content-Digest or
+// Want-Repr-Digest overrides the configured algorithms for that field and
+// enables it even if the config does not. The Content-Length set by next is
+// dropped so the writer decides the framing: bodies it can buffer get the
+// digests as headers, longer ones are chunked and get them as trailers.
+func Middleware(next server.Handler, config Config) server.Handler {
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = []string{"sha-256"}
+	}
+	return func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.Method != "HEAD" {
+			w.AddBodyFilter(config.filter(req))
+		}
+		next(w, req)
+	}
+}
+
+func (c Config) filter(req *request.Request) response.BodyFilter {
+	fields := map[string][]string{}
+	for _, f := range []struct {
+		name    string
+		want    string
+		enabled bool
+	}{
+		{"Content-Digest", "Want-Content-Digest", c.ContentDigest},
+		{"Repr-Digest", "Want-Repr-Digest", c.ReprDigest},
+	} {
+		if want, ok := req.Headers.Get(f.want); ok {
+			if alg := Preferred(want); alg != "" {
+				fields[f.name] = []string{alg}
+				continue
+			}
+		}
+		if f.enabled {
+			fields[f.name] = c.Algorithms
+		}
+	}
+	return func(statusCode response.StatusCode, h headers.Headers) func(io.Writer) io.WriteCloser {
+		if statusCode.HasNoBody() {
+			return nil
+		}
+		if statusCode == response.StatusCodePartialContent {
+			delete(fields, "Repr-Digest")
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+		h.Remove("Content-Length")
+		for name := range fields {
+			h.Remove(name)
+		}
+		return func(dst io.Writer) io.WriteCloser {
+			d := NewWriter(dst)
+			for name, algorithms := range fields {
+				d.AddField(name, algorithms...)
+			}
+			return d
+		}
+	}
+}
+
+// Writer passes bytes through to dst while hashing them, and reports the
+// results as digest fields. It implements response.FieldsWriter.
+type Writer struct {
+	dst    io.Writer
+	hashes map[string]hash.Hash
+	fields map[string][]string
+}
+
+var _ response.FieldsWriter = (*Writer)(nil)
+
+func NewWriter(dst io.Writer) *Writer {
+	return &Writer{
+		dst:    dst,
+		hashes: map[string]hash.Hash{},
+		fields: map[string][]string{},
+	}
+}
+
+// AddField reports the named field with the given algorithm keys; unknown
+// keys are ignored. It must be called before the first Write.
+func (d *Writer) AddField(name string, algorithms ...string) {
+	for _, alg := range algorithms {
+		newHash, ok := Algorithms[alg]
+		if !ok {
+			continue
+		}
+		if _, ok := d.hashes[alg]; !ok {
+			d.hashes[alg] = newHash()
+		}
+		d.fields[name] = append(d.fields[name], alg)
+	}
+}
+
+func (d *Writer) Write(p []byte) (int, error) {
+	n, err := d.dst.Write(p)
+	for _, h := range d.hashes {
+		h.Write(p[:n])
+	}
+	return n, err
+}
+
+// Close does not close dst.
+func (d *Writer) Close() error {
+	return nil
+}
+
+func (d *Writer) FieldNames() []string {
+	names := make([]string, 0, len(d.fields))
+	for name := range d.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (d *Writer) Fields() headers.Headers {
+	h := headers.NewHeaders()
+	for name, algorithms := range d.fields {
+		sums := make(map[string][]byte, len(algorithms))
+		for _, alg := range algorithms {
+			sums[alg] = d.hashes[alg].Sum(nil)
+		}
+		h.Override(name, Format(algorithms, sums))
+	}
+	return h
+}
+
+// Format writes digests as an RFC 9530 dictionary, e.g. "sha-256=:base64:",
+// in the order given by algorithms.
+func Format(algorithms []string, sums map[string][]byte) string {
+	items := make([]string, 0, len(algorithms))
+	for _, alg := range algorithms {
+		items = append(items, alg+"=:"+base64.StdEncoding.EncodeToString(sums[alg])+":")
+	}
+	return strings.Join(items, ", ")
+}
+
+// Parse reads a Content-Digest or Repr-Digest value into digests keyed by
+// algorithm. Parameters on members are ignored.
+func Parse(value string) (map[string][]byte, error) {
+	sums := map[string][]byte{}
+	for _, member := range strings.Split(value, ",") {
+		member, _, _ = strings.Cut(member, ";")
+		key, item, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed digest member %q", member)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		item = strings.TrimSpace(item)
+		if len(item) < 2 || item[0] != ':' || item[len(item)-1] != ':' {
+			return nil, fmt.Errorf("digest for %s is not a byte sequence", key)
+		}
+		sum, err := base64.StdEncoding.DecodeString(item[1 : len(item)-1])
+		if err != nil {
+			return nil, fmt.Errorf("digest for %s is not valid base64: %s", key, err)
+		}
+		sums[key] = sum
+	}
+	return sums, nil
+}
+
+// Preferred returns the supported algorithm a Want-Content-Digest or
+// Want-Repr-Digest value ranks highest, or "" if none is acceptable.
+// Preferences run from 1 to 10; 0 means not acceptable.
+func Preferred(want string) string {
+	best, bestWeight := "", 0
+	for _, member := range strings.Split(want, ",") {
+		member, _, _ = strings.Cut(member, ";")
+		key, weight, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		n, err := strconv.Atoi(strings.TrimSpace(weight))
+		if _, supported := Algorithms[key]; !supported || err != nil || n <= 0 {
+			continue
+		}
+		if n > bestWeight || n == bestWeight && key < best {
+			best, bestWeight = key, n
+		}
+	}
+	return best
+}
@@ -0,0 +1,131 @@
+package digest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"httpfromtcp/internal/compress"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveDigest(t *testing.T, raw string, handler server.Handler) *http.Response {
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	handler(w, req)
+	require.NoError(t, w.Finish())
+	resp, err := http.ReadResponse(bufio.NewReader(buf), &http.Request{Method: req.RequestLine.Method})
+	require.NoError(t, err)
+	return resp
+}
+
+func bodyHandler(body string) server.Handler {
+	return func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.Write([]byte(body))
+	}
+}
+
+func sha256Value(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+}
+
+func TestDigestHeaders(t *testing.T) {
+	config := Config{Algorithms: []string{"sha-256", "sha-512"}, ContentDigest: true, ReprDigest: true}
+	resp := serveDigest(t, "GET / HTTP/1.1\r\nHost: x\r\n\r\n", Middleware(bodyHandler("hello"), config))
+
+	// Test: Buffered body gets digests as headers with its length
+	sum512 := sha512.Sum512([]byte("hello"))
+	want := sha256Value([]byte("hello")) + ", sha-512=:" + base64.StdEncoding.EncodeToString(sum512[:]) + ":"
+	assert.Equal(t, want, resp.Header.Get("Content-Digest"))
+	assert.Equal(t, want, resp.Header.Get("Repr-Digest"))
+	assert.Equal(t, int64(5), resp.ContentLength)
+	assert.Empty(t, resp.Trailer)
+
+	// Test: HEAD responses are left alone
+	resp = serveDigest(t, "HEAD / HTTP/1.1\r\nHost: x\r\n\r\n", Middleware(bodyHandler(""), config))
+	assert.Empty(t, resp.Header.Get("Content-Digest"))
+}
+
+func TestDigestTrailers(t *testing.T) {
+	body := strings.Repeat("streamed body ", 1000)
+	resp := serveDigest(t, "GET / HTTP/1.1\r\nHost: x\r\n\r\n", Middleware(bodyHandler(body), DefaultConfig))
+
+	// Test: Long body is chunked with the digest as a trailer
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Empty(t, resp.Header.Get("Content-Digest"))
+	got, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(got))
+	assert.Equal(t, sha256Value([]byte(body)), resp.Trailer.Get("Content-Digest"))
+}
+
+func TestDigestWithHandlerTrailers(t *testing.T) {
+	handler := func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		h.Override("Trailer", "X-Count")
+		w.WriteHeaders(h)
+		w.WriteChunkedBody([]byte("abc"))
+		w.WriteChunkedBodyDone()
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Count", "3")
+		w.WriteTrailers(trailers)
+	}
+	resp := serveDigest(t, "GET / HTTP/1.1\r\nHost: x\r\n\r\n", Middleware(handler, DefaultConfig))
+
+	// Test: Digest trailer sent alongside the handler's own trailers
+	_, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "3", resp.Trailer.Get("X-Count"))
+	assert.Equal(t, sha256Value([]byte("abc")), resp.Trailer.Get("Content-Digest"))
+}
+
+func TestDigestPartialContent(t *testing.T) {
+	handler := func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusCodePartialContent)
+		w.WriteHeaders(response.GetDefaultHeaders(3))
+		w.Write([]byte("ell"))
+	}
+	config := Config{ContentDigest: true, ReprDigest: true}
+	resp := serveDigest(t, "GET / HTTP/1.1\r\nHost: x\r\n\r\n", Middleware(handler, config))
+
+	// Test: Partial content gets Content-Digest of the part but no Repr-Digest
+	assert.Equal(t, sha256Value([]byte("ell")), resp.Header.Get("Content-Digest"))
+	assert.Empty(t, resp.Header.Get("Repr-Digest"))
+}
+
+func TestDigestAfterCompression(t *testing.T) {
+	page := strings.Repeat("<p>compressible</p>\n", 100)
+	handler := func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		h := response.GetDefaultHeaders(len(page))
+		h.Override("Content-Type", "text/html")
+		w.WriteHeaders(h)
+		w.Write([]byte(page))
+	}
+	chain := compress.Middleware(Middleware(handler, DefaultConfig), compress.Config{MinSize: 16})
+	resp := serveDigest(t, "GET / HTTP/1.1\r\nHost: x\r\nAccept-Encoding: gzip\r\n\r\n", chain)
+
+	// Test: Digest covers the encoded bytes on the wire
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	encoded, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, sha256Value(encoded), resp.Trailer.Get("Content-Digest"))
+}
@@ -0,0 +1,76 @@
+package digest
+
+import (
+	"crypto/subtle"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"sort"
+	"strings"
+)
+
+type VerifyConfig struct {
+	// Require rejects requests with a body but no Content-Digest in a
+	// supported algorithm.
+	Require bool
+}
+
+// VerifyRequests checks the request body against its Content-Digest before
+// calling next and answers mismatches with 400. Every supported algorithm in
+// the field is checked; unsupported ones are ignored. It must run before
+// anything that decodes the body, since the digest covers the content as sent.
+func VerifyRequests(next server.Handler, config VerifyConfig) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		value, hasDigest := req.Headers.Get("Content-Digest")
+		if !hasDigest && !config.Require {
+			next(w, req)
+			return
+		}
+		body, err := req.ReadBody()
+		if err != nil {
+			response.Error(w, response.StatusCodeBadRequest, err.Error())
+			return
+		}
+		if !hasDigest && len(body) == 0 {
+			next(w, req)
+			return
+		}
+		var sums map[string][]byte
+		if hasDigest {
+			if sums, err = Parse(value); err != nil {
+				rejectDigest(w, err.Error())
+				return
+			}
+		}
+		checked := 0
+		for alg, want := range sums {
+			newHash, ok := Algorithms[alg]
+			if !ok {
+				continue
+			}
+			h := newHash()
+			h.Write(body)
+			if subtle.ConstantTimeCompare(h.Sum(nil), want) != 1 {
+				rejectDigest(w, "content-digest "+alg+" does not match the request body")
+				return
+			}
+			checked++
+		}
+		if checked == 0 && config.Require {
+			rejectDigest(w, "request requires a content-digest")
+			return
+		}
+		next(w, req)
+	}
+}
+
+// rejectDigest answers 400 and advertises the algorithms the server checks.
+func rejectDigest(w *response.Writer, message string) {
+	algorithms := make([]string, 0, len(Algorithms))
+	for alg := range Algorithms {
+		algorithms = append(algorithms, alg+"=5")
+	}
+	sort.Strings(algorithms)
+	w.Header().Override("Want-Content-Digest", strings.Join(algorithms, ", "))
+	response.Error(w, response.StatusCodeBadRequest, message)
+}
@@ -0,0 +1,112 @@
+package digest
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoBody(w *response.Writer, req *request.Request) {
+	body, _ := req.ReadBody()
+	w.WriteStatusLine(response.StatusCodeSuccess)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.Write(body)
+}
+
+func postWithDigest(body, digest string) string {
+	raw := "POST /upload HTTP/1.1\r\nHost: x\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n"
+	if digest != "" {
+		raw += "Content-Digest: " + digest + "\r\n"
+	}
+	return raw + "\r\n" + body
+}
+
+func TestParse(t *testing.T) {
+	// Test: Multiple members with parameters
+	sums, err := Parse("sha-256=:AAEC:, SHA-512=:AwQ=:;x=1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 2}, sums["sha-256"])
+	assert.Equal(t, []byte{3, 4}, sums["sha-512"])
+
+	// Test: Value that is not a byte sequence
+	_, err = Parse("sha-256=abc")
+	require.Error(t, err)
+
+	// Test: Invalid base64
+	_, err = Parse("sha-256=:!!:")
+	require.Error(t, err)
+}
+
+func TestPreferred(t *testing.T) {
+	// Test: Highest preference wins
+	assert.Equal(t, "sha-512", Preferred("sha-256=3, sha-512=10"))
+
+	// Test: Zero means not acceptable and unknown algorithms are skipped
+	assert.Equal(t, "sha-256", Preferred("sha-512=0, md5=10, sha-256=1"))
+
+	// Test: Nothing acceptable
+	assert.Equal(t, "", Preferred("unixsum=5"))
+}
+
+func TestVerifyRequests(t *testing.T) {
+	handler := VerifyRequests(echoBody, VerifyConfig{})
+
+	// Test: Matching digest accepted
+	resp := serveDigest(t, postWithDigest("hello", sha256Value([]byte("hello"))), handler)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: Mismatch rejected with 400 and supported algorithms advertised
+	resp = serveDigest(t, postWithDigest("hello", sha256Value([]byte("other"))), handler)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "sha-256=5, sha-512=5", resp.Header.Get("Want-Content-Digest"))
+
+	// Test: Every supported algorithm must match
+	sum512 := sha512.Sum512([]byte("tampered"))
+	resp = serveDigest(t, postWithDigest("hello", sha256Value([]byte("hello"))+", sha-512=:"+base64.StdEncoding.EncodeToString(sum512[:])+":"), handler)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Test: Unsupported algorithms ignored
+	resp = serveDigest(t, postWithDigest("hello", "unixsum=:AAAA:"), handler)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Test: Malformed field rejected
+	resp = serveDigest(t, postWithDigest("hello", "sha-256"), handler)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Test: Missing digest accepted unless required
+	resp = serveDigest(t, postWithDigest("hello", ""), handler)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = serveDigest(t, postWithDigest("hello", ""), VerifyRequests(echoBody, VerifyConfig{Require: true}))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestWantContentDigest(t *testing.T) {
+	handler := Middleware(bodyHandler("hello"), Config{})
+
+	// Test: No digest without config or Want-Content-Digest
+	resp := serveDigest(t, "GET / HTTP/1.1\r\nHost: x\r\n\r\n", handler)
+	assert.Empty(t, resp.Header.Get("Content-Digest"))
+	assert.Equal(t, int64(5), resp.ContentLength)
+
+	// Test: Requested algorithm used for the response
+	resp = serveDigest(t, "GET / HTTP/1.1\r\nHost: x\r\nWant-Content-Digest: sha-512=10, sha-256=1\r\n\r\n", handler)
+	sum512 := sha512.Sum512([]byte("hello"))
+	assert.Equal(t, "sha-512=:"+base64.StdEncoding.EncodeToString(sum512[:])+":", resp.Header.Get("Content-Digest"))
+	assert.Empty(t, resp.Header.Get("Repr-Digest"))
+
+	// Test: Want-Repr-Digest handled independently
+	resp = serveDigest(t, "GET / HTTP/1.1\r\nHost: x\r\nWant-Repr-Digest: sha-256=5\r\n\r\n", handler)
+	assert.Equal(t, sha256Value([]byte("hello")), resp.Header.Get("Repr-Digest"))
+	assert.Empty(t, resp.Header.Get("Content-Digest"))
+}
@@ -0,0 +1,237 @@
+package fileserver
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"html"
+	"httpfromtcp/internal/conditional"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/mime"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const indexPage = "index.html"
+
+type Config struct {
+	// StripPrefix is removed from the request path before it is looked up in the FS.
+	StripPrefix string
+	// ListDirectories renders an HTML listing for directories without an index.html.
+	ListDirectories bool
+}
+
+// Handler serves files from fsys, which may be an os.DirFS directory or an
+// embed.FS.
+func Handler(fsys fs.FS, config Config) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.Method != "GET" && req.RequestLine.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			serveError(w, response.StatusCodeMethodNotAllowed)
+			return
+		}
+		urlPath, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+		urlPath, err := url.PathUnescape(urlPath)
+		if err != nil {
+			serveError(w, response.StatusCodeBadRequest)
+			return
+		}
+		if !strings.HasPrefix(urlPath, config.StripPrefix) {
+			serveError(w, response.StatusCodeNotFound)
+			return
+		}
+		name := strings.TrimPrefix(urlPath, config.StripPrefix)
+		serve(w, req, fsys, name, config)
+	}
+}
+
+// ServeFile writes the named file from fsys as the response.
+func ServeFile(w *response.Writer, req *request.Request, fsys fs.FS, name string) {
+	serve(w, req, fsys, name, Config{})
+}
+
+func serve(w *response.Writer, req *request.Request, fsys fs.FS, name string, config Config) {
+	trailingSlash := strings.HasSuffix(name, "/")
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		serveError(w, statusForError(err))
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		serveError(w, statusForError(err))
+		return
+	}
+
+	if info.IsDir() {
+		if !trailingSlash {
+			target, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+			w.Header().Set("Location", target+"/")
+			serveError(w, response.StatusCodeMovedPermanently)
+			return
+		}
+		index, err := fsys.Open(path.Join(name, indexPage))
+		if err == nil {
+			defer index.Close()
+			indexInfo, err := index.Stat()
+			if err == nil && !indexInfo.IsDir() {
+				serveContent(w, req, index, indexInfo)
+				return
+			}
+		}
+		if !config.ListDirectories {
+			serveError(w, response.StatusCodeForbidden)
+			return
+		}
+		serveDirectory(w, fsys, name)
+		return
+	}
+	serveContent(w, req, f, info)
+}
+
+func serveContent(w *response.Writer, req *request.Request, f fs.File, info fs.FileInfo) {
+	h := w.Header()
+	seeker, canSeek := f.(io.ReadSeeker)
+	etag := ETag(info)
+	if info.ModTime().IsZero() {
+		// without a modification time, such as in an embed.FS, only the
+		// content tells versions of the same size apart
+		etag = ""
+		if canSeek {
+			var err error
+			if etag, err = contentETag(seeker); err != nil {
+				serveError(w, response.StatusCodeInternalServerError)
+				return
+			}
+		}
+	} else {
+		h.Override("Last-Modified", headers.FormatTime(info.ModTime()))
+	}
+	if etag != "" {
+		h.Override("ETag", etag)
+	}
+	if conditional.Check(w, req) {
+		return
+	}
+
+	var sniffed []byte
+	contentType := mime.TypeByExtension(filepath.Ext(info.Name()))
+	if contentType == "" {
+		sniffed = make([]byte, mime.SniffLen)
+		n, err := io.ReadFull(f, sniffed)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			serveError(w, response.StatusCodeInternalServerError)
+			return
+		}
+		sniffed = sniffed[:n]
+		contentType = mime.Sniff(sniffed)
+	}
+	h.Override("Content-Type", contentType)
+
+	if canSeek {
+		h.Override("Accept-Ranges", "bytes")
+		// Range only applies to GET (RFC 9110 section 14.2)
+		rangeHeader, ok := req.Headers.Get("Range")
+		if ok && req.RequestLine.Method == "GET" && conditional.IfRange(req, etag, info.ModTime()) {
+			if sniffed != nil {
+				if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+					serveError(w, response.StatusCodeInternalServerError)
+					return
+				}
+			}
+			if serveRanges(w, seeker, rangeHeader, info.Size(), contentType) {
+				return
+			}
+			if _, err := seeker.Seek(int64(len(sniffed)), io.SeekStart); err != nil {
+				serveError(w, response.StatusCodeInternalServerError)
+				return
+			}
+		}
+	}
+
+	h.Override("Content-Length", strconv.FormatInt(info.Size(), 10))
+	if err := w.WriteStatusLine(response.StatusCodeSuccess); err != nil {
+		return
+	}
+	if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+		return
+	}
+	if req.RequestLine.Method == "HEAD" {
+		// the body would only be discarded; don't read the file for it
+		return
+	}
+	if _, err := w.Write(sniffed); err != nil {
+		return
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("error streaming %s: %v", info.Name(), err)
+	}
+}
+
+// ETag derives a strong validator from the file's size and modification time.
+// Files without a modification time are served with a content hash instead.
+func ETag(info fs.FileInfo) string {
+	return fmt.Sprintf("\"%x-%x\"", info.ModTime().UnixNano(), info.Size())
+}
+
+// contentETag hashes the rest of f and rewinds it to the start.
+func contentETag(f io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("\"%x\"", hash.Sum(nil)[:16]), nil
+}
+
+func serveDirectory(w *response.Writer, fsys fs.FS, name string) {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		serveError(w, statusForError(err))
+		return
+	}
+	w.Header().Override("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<html>\n<head>\n<title>Index of /%s</title>\n</head>\n<body>\n<ul>\n", html.EscapeString(name))
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		href := "./" + (&url.URL{Path: entryName}).EscapedPath()
+		fmt.Fprintf(w, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(entryName))
+	}
+	fmt.Fprintf(w, "</ul>\n</body>\n</html>\n")
+}
+
+func statusForError(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrInvalid):
+		return response.StatusCodeNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return response.StatusCodeForbidden
+	default:
+		return response.StatusCodeInternalServerError
+	}
+}
+
+func serveError(w *response.Writer, statusCode response.StatusCode) {
+	w.Header().Remove("Last-Modified")
+	w.Header().Remove("ETag")
+	response.Error(w, statusCode, "")
+}
@@ -0,0 +1,191 @@
+package fileserver
+
+import (
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFS = fstest.MapFS{
+	"hello.txt":         {Data: []byte("hello world"), ModTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	"noext":             {Data: []byte("<html><p>hi</p></html>")},
+	"site/index.html":   {Data: []byte("<h1>home</h1>")},
+	"files/a.txt":       {Data: []byte("a")},
+	"files/b & c.txt":   {Data: []byte("b")},
+	"secret/.gitignore": {Data: []byte("")},
+}
+
+func serveTest(t *testing.T, method, target string, config Config) string {
+	req, err := request.RequestFromReader(strings.NewReader(method + " " + target + " HTTP/1.1\r\nHost: x\r\n\r\n"))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	if method == "HEAD" {
+		w.OmitBody()
+	}
+	Handler(testFS, config)(w, req)
+	require.NoError(t, w.Finish())
+	return buf.String()
+}
+
+func TestFileServer(t *testing.T) {
+	// Test: Regular file with validators
+	resp := serveTest(t, "GET", "/static/hello.txt", Config{StripPrefix: "/static"})
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "content-type: text/plain; charset=utf-8\r\n")
+	assert.Contains(t, resp, "content-length: 11\r\n")
+	assert.Contains(t, resp, "last-modified: Tue, 02 Jan 2024 03:04:05 GMT\r\n")
+	assert.Contains(t, resp, "etag: \"")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nhello world"))
+
+	// Test: HEAD sends headers only
+	resp = serveTest(t, "HEAD", "/hello.txt", Config{})
+	assert.Contains(t, resp, "content-length: 11\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n"))
+
+	// Test: Sniffed content type for unknown extension
+	resp = serveTest(t, "GET", "/noext", Config{})
+	assert.Contains(t, resp, "content-type: text/html; charset=utf-8\r\n")
+	assert.True(t, strings.HasSuffix(resp, "<html><p>hi</p></html>"))
+
+	// Test: Directory index
+	resp = serveTest(t, "GET", "/site/", Config{})
+	assert.True(t, strings.HasSuffix(resp, "<h1>home</h1>"))
+
+	// Test: Directory without slash redirects
+	resp = serveTest(t, "GET", "/site", Config{})
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 301 Moved Permanently\r\n"))
+	assert.Contains(t, resp, "location: /site/\r\n")
+
+	// Test: Directory listing
+	resp = serveTest(t, "GET", "/files/", Config{ListDirectories: true})
+	assert.Contains(t, resp, "<a href=\"./a.txt\">a.txt</a>")
+	assert.Contains(t, resp, "<a href=\"./b%20&amp;%20c.txt\">b &amp; c.txt</a>")
+
+	// Test: Directory listing disabled
+	resp = serveTest(t, "GET", "/files/", Config{})
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 403 Forbidden\r\n"))
+
+	// Test: Missing file
+	resp = serveTest(t, "GET", "/missing.txt", Config{})
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Path traversal stays inside the FS
+	resp = serveTest(t, "GET", "/files/../../hello.txt", Config{})
+	assert.True(t, strings.HasSuffix(resp, "hello world"))
+
+	// Test: Unsupported method
+	resp = serveTest(t, "POST", "/hello.txt", Config{})
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, resp, "allow: GET, HEAD\r\n")
+}
+
+func TestFileServerConditional(t *testing.T) {
+	// Test: Matching If-None-Match gives 304
+	req, err := request.RequestFromReader(strings.NewReader("GET /hello.txt HTTP/1.1\r\nHost: x\r\n\r\n"))
+	require.NoError(t, err)
+	info, err := testFS.Stat("hello.txt")
+	require.NoError(t, err)
+	req.Headers.Set("If-None-Match", ETag(info))
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	Handler(testFS, Config{})(w, req)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 304 Not Modified\r\n"))
+	assert.NotContains(t, buf.String(), "hello world")
+
+	// Test: If-Modified-Since in the past sends the file
+	resp := serveRangeTest(t, "If-Modified-Since: Mon, 01 Jan 2024 00:00:00 GMT\r\n")
+	assert.True(t, strings.HasSuffix(resp, "hello world"))
+}
+
+// countingFS counts the bytes read from the files it opens.
+type countingFS struct {
+	fs.FS
+	read *int
+}
+
+func (c countingFS) Open(name string) (fs.File, error) {
+	f, err := c.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return countingFile{f, c.read}, nil
+}
+
+type countingFile struct {
+	fs.File
+	read *int
+}
+
+func (f countingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	*f.read += n
+	return n, err
+}
+
+func (f countingFile) Seek(offset int64, whence int) (int64, error) {
+	return f.File.(io.Seeker).Seek(offset, whence)
+}
+
+func TestFileServerHeadSkipsFile(t *testing.T) {
+	var read int
+	fsys := countingFS{testFS, &read}
+	req, err := request.RequestFromReader(strings.NewReader("HEAD /hello.txt HTTP/1.1\r\nHost: x\r\n\r\n"))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	w.OmitBody()
+	Handler(fsys, Config{})(w, req)
+	require.NoError(t, w.Finish())
+
+	// Test: HEAD answers with the full length without reading the file
+	assert.Contains(t, buf.String(), "content-length: 11\r\n")
+	assert.Zero(t, read)
+}
+
+func TestFileServerWithoutModTime(t *testing.T) {
+	serve := func(fsys fstest.MapFS, extra string) string {
+		req, err := request.RequestFromReader(strings.NewReader("GET /page.txt HTTP/1.1\r\nHost: x\r\n" + extra + "\r\n"))
+		require.NoError(t, err)
+		buf := &bytes.Buffer{}
+		w := response.NewWriter(buf)
+		Handler(fsys, Config{})(w, req)
+		require.NoError(t, w.Finish())
+		return buf.String()
+	}
+	etagOf := func(resp string) string {
+		_, rest, ok := strings.Cut(resp, "etag: ")
+		require.True(t, ok)
+		etag, _, _ := strings.Cut(rest, "\r\n")
+		return etag
+	}
+
+	// Test: No Last-Modified and a content-based ETag
+	v1 := fstest.MapFS{"page.txt": {Data: []byte("version 1")}}
+	resp := serve(v1, "")
+	assert.NotContains(t, resp, "last-modified")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nversion 1"))
+	etag := etagOf(resp)
+
+	// Test: Same content revalidates, same-size edit does not
+	resp = serve(v1, "If-None-Match: "+etag+"\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 304 Not Modified\r\n"))
+	v2 := fstest.MapFS{"page.txt": {Data: []byte("version 2")}}
+	resp = serve(v2, "If-None-Match: "+etag+"\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nversion 2"))
+	assert.NotEqual(t, etag, etagOf(resp))
+
+	// Test: If-Modified-Since ignored without a modification time
+	resp = serve(v2, "If-Modified-Since: Mon, 01 Jan 2024 00:00:00 GMT\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nversion 2"))
+}
@@ -0,0 +1,170 @@
+package fileserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/response"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// ByteRange is an inclusive-exclusive span [Start, Start+Length) of a representation.
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+func (r ByteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+var (
+	ErrInvalidRange       = errors.New("invalid range")
+	ErrUnsatisfiableRange = errors.New("unsatisfiable range")
+)
+
+// ParseRange parses a bytes Range header (RFC 9110 section 14.1.2) against a
+// representation of the given size. Ranges that start past the end are
+// dropped; if none remain ErrUnsatisfiableRange is returned.
+func ParseRange(value string, size int64) ([]ByteRange, error) {
+	unit, set, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(unit) != "bytes" {
+		return nil, ErrInvalidRange
+	}
+	var ranges []ByteRange
+	for _, spec := range strings.Split(set, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, ErrInvalidRange
+		}
+		if first == "" {
+			// suffix-range: the final N bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, ErrInvalidRange
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			ranges = append(ranges, ByteRange{Start: size - n, Length: n})
+			continue
+		}
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return nil, ErrInvalidRange
+		}
+		end := size - 1
+		if last != "" {
+			end, err = strconv.ParseInt(last, 10, 64)
+			if err != nil || end < start {
+				return nil, ErrInvalidRange
+			}
+			if end >= size {
+				end = size - 1
+			}
+		}
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, ByteRange{Start: start, Length: end - start + 1})
+	}
+	if len(ranges) == 0 {
+		return nil, ErrUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+// serveRanges writes a 206 or 416 response. It returns false if the Range
+// header should be ignored and the full representation sent instead.
+func serveRanges(w *response.Writer, f io.ReadSeeker, rangeHeader string, size int64, contentType string) bool {
+	ranges, err := ParseRange(rangeHeader, size)
+	if errors.Is(err, ErrUnsatisfiableRange) {
+		w.Header().Override("Content-Range", fmt.Sprintf("bytes */%d", size))
+		serveError(w, response.StatusCodeRangeNotSatisfiable)
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	var total int64
+	for _, r := range ranges {
+		total += r.Length
+	}
+	if total > size {
+		// overlapping ranges asking for more than the whole file are not worth honouring
+		return false
+	}
+
+	h := w.Header()
+	if len(ranges) == 1 {
+		h.Override("Content-Range", ranges[0].contentRange(size))
+		h.Override("Content-Length", strconv.FormatInt(ranges[0].Length, 10))
+		if err := w.WriteStatusLine(response.StatusCodePartialContent); err != nil {
+			return true
+		}
+		if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+			return true
+		}
+		copyRange(w, f, ranges[0])
+		return true
+	}
+
+	boundary := randomBoundary()
+	partHeaders := make([]string, len(ranges))
+	length := int64(0)
+	for i, r := range ranges {
+		partHeaders[i] = fmt.Sprintf("\r\n--%s\r\nContent-Type: %s\r\nContent-Range: %s\r\n\r\n", boundary, contentType, r.contentRange(size))
+		length += int64(len(partHeaders[i])) + r.Length
+	}
+	closing := fmt.Sprintf("\r\n--%s--\r\n", boundary)
+	length += int64(len(closing))
+
+	h.Override("Content-Type", "multipart/byteranges; boundary="+boundary)
+	h.Override("Content-Length", strconv.FormatInt(length, 10))
+	if err := w.WriteStatusLine(response.StatusCodePartialContent); err != nil {
+		return true
+	}
+	if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+		return true
+	}
+	for i, r := range ranges {
+		if _, err := io.WriteString(w, partHeaders[i]); err != nil {
+			return true
+		}
+		if !copyRange(w, f, r) {
+			return true
+		}
+	}
+	io.WriteString(w, closing)
+	return true
+}
+
+func copyRange(w io.Writer, f io.ReadSeeker, r ByteRange) bool {
+	if _, err := f.Seek(r.Start, io.SeekStart); err != nil {
+		log.Printf("error seeking to range %d: %v", r.Start, err)
+		return false
+	}
+	if _, err := io.CopyN(w, f, r.Length); err != nil {
+		log.Printf("error streaming range %d-%d: %v", r.Start, r.Start+r.Length-1, err)
+		return false
+	}
+	return true
+}
+
+func randomBoundary() string {
+	var buf [16]byte
+	rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
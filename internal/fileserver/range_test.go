@@ -0,0 +1,107 @@
+package fileserver
+
+import (
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	// Test: Single closed range
+	ranges, err := ParseRange("bytes=0-4", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 0, Length: 5}}, ranges)
+
+	// Test: Open ended and suffix ranges
+	ranges, err = ParseRange("bytes=7-, -2", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 7, Length: 3}, {Start: 8, Length: 2}}, ranges)
+
+	// Test: Last position clamped to the size
+	ranges, err = ParseRange("bytes=5-100", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 5, Length: 5}}, ranges)
+
+	// Test: Suffix larger than the representation
+	ranges, err = ParseRange("bytes=-100", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 0, Length: 10}}, ranges)
+
+	// Test: Unsatisfiable range
+	_, err = ParseRange("bytes=10-20", 10)
+	require.ErrorIs(t, err, ErrUnsatisfiableRange)
+
+	// Test: Invalid unit
+	_, err = ParseRange("items=0-1", 10)
+	require.ErrorIs(t, err, ErrInvalidRange)
+
+	// Test: Invalid reversed range
+	_, err = ParseRange("bytes=5-1", 10)
+	require.ErrorIs(t, err, ErrInvalidRange)
+}
+
+func serveRangeTest(t *testing.T, extraHeaders string) string {
+	req, err := request.RequestFromReader(strings.NewReader("GET /hello.txt HTTP/1.1\r\nHost: x\r\n" + extraHeaders + "\r\n"))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	Handler(testFS, Config{})(w, req)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.Reusable())
+	return buf.String()
+}
+
+func TestServeRanges(t *testing.T) {
+	// Test: Full response advertises range support
+	resp := serveRangeTest(t, "")
+	assert.Contains(t, resp, "accept-ranges: bytes\r\n")
+
+	// Test: Single range
+	resp = serveRangeTest(t, "Range: bytes=6-\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 206 Partial Content\r\n"))
+	assert.Contains(t, resp, "content-range: bytes 6-10/11\r\n")
+	assert.Contains(t, resp, "content-length: 5\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nworld"))
+
+	// Test: Multiple ranges
+	resp = serveRangeTest(t, "Range: bytes=0-1, -2\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 206 Partial Content\r\n"))
+	assert.Contains(t, resp, "content-type: multipart/byteranges; boundary=")
+	assert.Contains(t, resp, "Content-Range: bytes 0-1/11\r\n\r\nhe\r\n--")
+	assert.Contains(t, resp, "Content-Range: bytes 9-10/11\r\n\r\nld\r\n--")
+
+	// Test: Unsatisfiable range
+	resp = serveRangeTest(t, "Range: bytes=50-\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 416 Range Not Satisfiable\r\n"))
+	assert.Contains(t, resp, "content-range: bytes */11\r\n")
+
+	// Test: If-Range with matching date honours the range
+	resp = serveRangeTest(t, "Range: bytes=0-4\r\nIf-Range: Tue, 02 Jan 2024 03:04:05 GMT\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 206 Partial Content\r\n"))
+
+	// Test: If-Range with stale ETag sends the full file
+	resp = serveRangeTest(t, "Range: bytes=0-4\r\nIf-Range: \"stale\"\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(resp, "hello world"))
+
+	// Test: Invalid range syntax is ignored
+	resp = serveRangeTest(t, "Range: bytes=x-y\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: Range is ignored for HEAD
+	req, err := request.RequestFromReader(strings.NewReader("HEAD /hello.txt HTTP/1.1\r\nHost: x\r\nRange: bytes=0-4\r\n\r\n"))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	w.OmitBody()
+	Handler(testFS, Config{})(w, req)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, buf.String(), "content-length: 11\r\n")
+	assert.NotContains(t, buf.String(), "content-range")
+}
@@ -0,0 +1,31 @@
+package headers
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeFormat is the IMF-fixdate format used for HTTP-date fields.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// obsolete HTTP-date formats recipients must still accept (RFC 9110 section 5.6.7)
+var obsTimeFormats = []string{
+	"Monday, 02-Jan-06 15:04:05 GMT",
+	"Mon Jan _2 15:04:05 2006",
+}
+
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(TimeFormat, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range obsTimeFormats {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid HTTP-date: %s", value)
+}
@@ -39,47 +39,125 @@ func (h Headers) Get(key string) (string, bool) {
 	return v, ok
 }
 
+// HasToken reports whether the comma-separated list in key contains token,
+// compared case-insensitively.
+func (h Headers) HasToken(key, token string) bool {
+	v, ok := h.Get(key)
+	if !ok {
+		return false
+	}
+	for _, item := range strings.Split(v, ",") {
+		if strings.EqualFold(strings.TrimSpace(item), token) {
+			return true
+		}
+	}
+	return false
+}
+
 const crlf = "\r\n"
 
+// ParseOptions relaxes the RFC 9112 field-line grammar. The zero value is strict.
+type ParseOptions struct {
+	AllowBareLF          bool
+	AllowExtraWhitespace bool
+	AllowObsText         bool
+}
+
 func (h Headers) Parse(data []byte) (n int, done bool, err error) {
-	idx := bytes.Index(data, []byte(crlf))
+	return h.ParseWithOptions(data, ParseOptions{})
+}
+
+func (h Headers) ParseWithOptions(data []byte, opts ParseOptions) (n int, done bool, err error) {
+	idx, sepLen := FindLineEnd(data, opts.AllowBareLF)
 	if idx == -1 {
 		return 0, false, nil
 	} else if idx == 0 {
-		return 2, true, nil
+		return sepLen, true, nil
 	}
 
-	headerFieldName, headerFieldValue, err := retrieveHeaderParts(data, idx, byte(':'))
+	headerFieldName, headerFieldValue, err := retrieveHeaderParts(data[:idx], opts)
 	if err != nil {
 		return 0, false, err
 	}
-	value, ok := h[headerFieldName]
-	if ok {
-		h.Set(headerFieldName, value+", "+headerFieldValue)
-	} else {
-		h.Set(headerFieldName, headerFieldValue)
+	h.Set(headerFieldName, headerFieldValue)
+	return idx + sepLen, false, nil
+}
+
+// FindLineEnd returns the index of the line terminator in data and its length,
+// or -1 if no complete line is buffered yet.
+func FindLineEnd(data []byte, allowBareLF bool) (idx int, sepLen int) {
+	if !allowBareLF {
+		return bytes.Index(data, []byte(crlf)), len(crlf)
+	}
+	idx = bytes.IndexByte(data, '\n')
+	if idx == -1 {
+		return -1, 0
+	}
+	if idx > 0 && data[idx-1] == '\r' {
+		return idx - 1, 2
 	}
-	return idx + 2, false, nil
+	return idx, 1
 }
 
-func retrieveHeaderParts(data []byte, idx int, char byte) (headerFieldName, headerFieldValue string, err error) {
-	parts := bytes.SplitN(data[:idx], []byte(":"), 2)
+func retrieveHeaderParts(line []byte, opts ParseOptions) (headerFieldName, headerFieldValue string, err error) {
+	parts := bytes.SplitN(line, []byte(":"), 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("malformed header line, missing \":\" seperator")
+	}
 
 	headerFieldName = strings.ToLower(string(parts[0]))
 	headerFieldValue = string(parts[1])
 
-	if headerFieldName[len(headerFieldName)-1] == ' ' {
+	if !opts.AllowExtraWhitespace && strings.TrimRight(headerFieldName, " \t") != headerFieldName {
 		return "", "", fmt.Errorf("incorrect header name format, trailing whitespace before the \":\" seperator")
 	}
 
-	headerFieldName = strings.Trim(headerFieldName, " ")
-	headerFieldValue = strings.Trim(headerFieldValue, " ")
+	headerFieldName = strings.Trim(headerFieldName, " \t")
+	headerFieldValue = strings.Trim(headerFieldValue, " \t")
 
-	for _, c := range headerFieldName {
-		if (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') && (c < 0 || c > 9) && (!strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
-			return "", "", fmt.Errorf("invalid characters in header field-name")
-		}
+	if !IsToken(headerFieldName) {
+		return "", "", fmt.Errorf("invalid characters in header field-name")
+	}
+	if !IsFieldValue(headerFieldValue, opts.AllowObsText) {
+		return "", "", fmt.Errorf("invalid characters in header field-value for %s", headerFieldName)
 	}
 
 	return headerFieldName, headerFieldValue, nil
 }
+
+// IsToken reports whether s matches the RFC 9110 token rule: 1*tchar.
+func IsToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTchar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTchar(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+}
+
+// IsFieldValue reports whether s is a valid RFC 9110 field-value with the
+// surrounding whitespace already removed. obs-text (%x80-FF) is only accepted
+// when allowObsText is set.
+func IsFieldValue(s string, allowObsText bool) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+		case c >= 0x21 && c <= 0x7e:
+		case c >= 0x80:
+			if !allowObsText {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
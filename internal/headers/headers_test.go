@@ -102,4 +102,72 @@ func TestHeaderParse(t *testing.T) {
 	require.Error(t, err)
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
+
+	// Test: Valid with digits in field-name
+	headers = NewHeaders()
+	data = []byte("X-Forwarded-For2: 10.0.0.1\r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", headers["x-forwarded-for2"])
+	assert.Equal(t, 28, n)
+	assert.False(t, done)
+
+	// Test: Invalid missing colon
+	headers = NewHeaders()
+	data = []byte("Host localhost:42069\r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.Error(t, err)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+
+	// Test: Invalid control character in field-value
+	headers = NewHeaders()
+	data = []byte("Host: local\x00host\r\n\r\n")
+	_, _, err = headers.Parse(data)
+	require.Error(t, err)
+
+	// Test: Invalid obs-text in field-value in strict mode
+	headers = NewHeaders()
+	data = []byte("X-Name: caf\xe9\r\n\r\n")
+	_, _, err = headers.Parse(data)
+	require.Error(t, err)
+}
+
+func TestHeaderParseLenient(t *testing.T) {
+	opts := ParseOptions{AllowBareLF: true, AllowExtraWhitespace: true, AllowObsText: true}
+
+	// Test: Valid bare LF line ending
+	headers := NewHeaders()
+	data := []byte("Host: localhost:42069\n\n")
+	n, done, err := headers.ParseWithOptions(data, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, 22, n)
+	assert.False(t, done)
+
+	// Test: Valid bare LF done
+	n, done, err = headers.ParseWithOptions(data[n:], opts)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.True(t, done)
+
+	// Test: Valid whitespace before colon
+	headers = NewHeaders()
+	data = []byte("Host \t: localhost:42069\r\n\r\n")
+	_, _, err = headers.ParseWithOptions(data, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:42069", headers["host"])
+
+	// Test: Valid obs-text in field-value
+	headers = NewHeaders()
+	data = []byte("X-Name: caf\xe9\r\n\r\n")
+	_, _, err = headers.ParseWithOptions(data, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "caf\xe9", headers["x-name"])
+
+	// Test: Invalid control character in field-value
+	headers = NewHeaders()
+	data = []byte("Host: local\x00host\r\n\r\n")
+	_, _, err = headers.ParseWithOptions(data, opts)
+	require.Error(t, err)
 }
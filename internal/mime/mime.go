@@ -0,0 +1,62 @@
+package mime
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	mu         sync.RWMutex
+	extensions = map[string]string{
+		".css":   "text/css; charset=utf-8",
+		".csv":   "text/csv; charset=utf-8",
+		".gif":   "image/gif",
+		".gz":    "application/gzip",
+		".htm":   "text/html; charset=utf-8",
+		".html":  "text/html; charset=utf-8",
+		".ico":   "image/vnd.microsoft.icon",
+		".jpeg":  "image/jpeg",
+		".jpg":   "image/jpeg",
+		".js":    "text/javascript; charset=utf-8",
+		".json":  "application/json",
+		".md":    "text/markdown; charset=utf-8",
+		".mjs":   "text/javascript; charset=utf-8",
+		".mp3":   "audio/mpeg",
+		".mp4":   "video/mp4",
+		".ogg":   "application/ogg",
+		".pdf":   "application/pdf",
+		".png":   "image/png",
+		".svg":   "image/svg+xml",
+		".txt":   "text/plain; charset=utf-8",
+		".wasm":  "application/wasm",
+		".wav":   "audio/wav",
+		".webm":  "video/webm",
+		".webp":  "image/webp",
+		".woff":  "font/woff",
+		".woff2": "font/woff2",
+		".xml":   "text/xml; charset=utf-8",
+		".zip":   "application/zip",
+	}
+)
+
+// TypeByExtension returns the MIME type registered for ext, which must include
+// the leading dot. Lookups are case-insensitive; "" means unknown.
+func TypeByExtension(ext string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return extensions[strings.ToLower(ext)]
+}
+
+func AddExtensionType(ext, typ string) error {
+	if !strings.HasPrefix(ext, ".") {
+		return fmt.Errorf("extension %q must begin with a dot", ext)
+	}
+	if !strings.Contains(typ, "/") {
+		return fmt.Errorf("invalid mime type %q", typ)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	extensions[strings.ToLower(ext)] = typ
+	return nil
+}
@@ -0,0 +1,192 @@
+package mime
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// SniffLen is the number of leading bytes Sniff looks at.
+const SniffLen = 512
+
+// Sniff determines the MIME type of data following the WHATWG "identifying a
+// resource with an unknown MIME type" algorithm, with the sniff-scriptable
+// flag set. It always returns a valid type, falling back to
+// application/octet-stream.
+func Sniff(data []byte) string {
+	if len(data) > SniffLen {
+		data = data[:SniffLen]
+	}
+	for _, s := range sniffers {
+		if t := s.match(data); t != "" {
+			return t
+		}
+	}
+	if containsBinaryData(data) {
+		return "application/octet-stream"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+type sniffer interface {
+	match(data []byte) string
+}
+
+var sniffers = []sniffer{
+	htmlSig("<!DOCTYPE HTML"),
+	htmlSig("<HTML"),
+	htmlSig("<HEAD"),
+	htmlSig("<SCRIPT"),
+	htmlSig("<IFRAME"),
+	htmlSig("<H1"),
+	htmlSig("<DIV"),
+	htmlSig("<FONT"),
+	htmlSig("<TABLE"),
+	htmlSig("<A"),
+	htmlSig("<STYLE"),
+	htmlSig("<TITLE"),
+	htmlSig("<B"),
+	htmlSig("<BODY"),
+	htmlSig("<BR"),
+	htmlSig("<P"),
+	htmlSig("<!--"),
+	&maskedSig{pat: []byte("<?xml"), skipWS: true, ct: "text/xml; charset=utf-8"},
+	exactSig("%PDF-", "application/pdf"),
+	exactSig("%!PS-Adobe-", "application/postscript"),
+
+	// byte order marks
+	exactSig("\xFE\xFF", "text/plain; charset=utf-16be"),
+	exactSig("\xFF\xFE", "text/plain; charset=utf-16le"),
+	exactSig("\xEF\xBB\xBF", "text/plain; charset=utf-8"),
+
+	// images
+	exactSig("\x00\x00\x01\x00", "image/x-icon"),
+	exactSig("\x00\x00\x02\x00", "image/x-icon"),
+	exactSig("BM", "image/bmp"),
+	exactSig("GIF87a", "image/gif"),
+	exactSig("GIF89a", "image/gif"),
+	&maskedSig{pat: []byte("RIFF\x00\x00\x00\x00WEBPVP"), mask: []byte("\xFF\xFF\xFF\xFF\x00\x00\x00\x00\xFF\xFF\xFF\xFF\xFF\xFF"), ct: "image/webp"},
+	exactSig("\x89PNG\x0D\x0A\x1A\x0A", "image/png"),
+	exactSig("\xFF\xD8\xFF", "image/jpeg"),
+
+	// audio and video
+	&maskedSig{pat: []byte("FORM\x00\x00\x00\x00AIFF"), mask: []byte("\xFF\xFF\xFF\xFF\x00\x00\x00\x00\xFF\xFF\xFF\xFF"), ct: "audio/aiff"},
+	exactSig("ID3", "audio/mpeg"),
+	exactSig("OggS\x00", "application/ogg"),
+	exactSig("MThd\x00\x00\x00\x06", "audio/midi"),
+	&maskedSig{pat: []byte("RIFF\x00\x00\x00\x00AVI "), mask: []byte("\xFF\xFF\xFF\xFF\x00\x00\x00\x00\xFF\xFF\xFF\xFF"), ct: "video/avi"},
+	&maskedSig{pat: []byte("RIFF\x00\x00\x00\x00WAVE"), mask: []byte("\xFF\xFF\xFF\xFF\x00\x00\x00\x00\xFF\xFF\xFF\xFF"), ct: "audio/wave"},
+	mp4Sig{},
+	exactSig("\x1A\x45\xDF\xA3", "video/webm"),
+
+	// fonts
+	exactSig("\x00\x01\x00\x00", "font/ttf"),
+	exactSig("OTTO", "font/otf"),
+	exactSig("ttcf", "font/collection"),
+	exactSig("wOFF", "font/woff"),
+	exactSig("wOF2", "font/woff2"),
+
+	// archives
+	exactSig("\x1F\x8B\x08", "application/x-gzip"),
+	exactSig("PK\x03\x04", "application/zip"),
+	exactSig("Rar!\x1A\x07\x00", "application/x-rar-compressed"),
+	exactSig("Rar!\x1A\x07\x01\x00", "application/x-rar-compressed"),
+	exactSig("\x00asm", "application/wasm"),
+}
+
+type maskedSig struct {
+	pat    []byte
+	mask   []byte
+	skipWS bool
+	ct     string
+}
+
+func exactSig(pat, ct string) *maskedSig {
+	return &maskedSig{pat: []byte(pat), ct: ct}
+}
+
+func (m *maskedSig) match(data []byte) string {
+	if m.skipWS {
+		data = trimLeadingWS(data)
+	}
+	if len(data) < len(m.pat) {
+		return ""
+	}
+	for i, p := range m.pat {
+		b := data[i]
+		if m.mask != nil {
+			b &= m.mask[i]
+		}
+		if b != p {
+			return ""
+		}
+	}
+	return m.ct
+}
+
+// htmlSig matches case-insensitively after leading whitespace and requires
+// the tag to be terminated by a space or '>'.
+type htmlSig []byte
+
+func (h htmlSig) match(data []byte) string {
+	data = trimLeadingWS(data)
+	if len(data) < len(h)+1 {
+		return ""
+	}
+	for i, b := range h {
+		db := data[i]
+		if 'A' <= b && b <= 'Z' {
+			db &= 0xDF
+		}
+		if b != db {
+			return ""
+		}
+	}
+	if db := data[len(h)]; db != ' ' && db != '>' {
+		return ""
+	}
+	return "text/html; charset=utf-8"
+}
+
+type mp4Sig struct{}
+
+func (mp4Sig) match(data []byte) string {
+	if len(data) < 12 {
+		return ""
+	}
+	boxSize := int(binary.BigEndian.Uint32(data[:4]))
+	if len(data) < boxSize || boxSize%4 != 0 {
+		return ""
+	}
+	if !bytes.Equal(data[4:8], []byte("ftyp")) {
+		return ""
+	}
+	if bytes.Equal(data[8:11], []byte("mp4")) {
+		return "video/mp4"
+	}
+	for st := 16; st+3 <= boxSize; st += 4 {
+		if bytes.Equal(data[st:st+3], []byte("mp4")) {
+			return "video/mp4"
+		}
+	}
+	return ""
+}
+
+func trimLeadingWS(data []byte) []byte {
+	for len(data) > 0 && isWS(data[0]) {
+		data = data[1:]
+	}
+	return data
+}
+
+func isWS(b byte) bool {
+	return b == '\t' || b == '\n' || b == '\x0C' || b == '\r' || b == ' '
+}
+
+func containsBinaryData(data []byte) bool {
+	for _, b := range data {
+		if b <= 0x08 || b == 0x0B || (b >= 0x0E && b <= 0x1A) || (b >= 0x1C && b <= 0x1F) {
+			return true
+		}
+	}
+	return false
+}
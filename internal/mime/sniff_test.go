@@ -0,0 +1,63 @@
+package mime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniff(t *testing.T) {
+	// Test: HTML with leading whitespace and mixed case tag
+	assert.Equal(t, "text/html; charset=utf-8", Sniff([]byte("\n  <hTmL><body>hi</body></html>")))
+
+	// Test: HTML tag must be terminated
+	assert.Equal(t, "text/plain; charset=utf-8", Sniff([]byte("<Bold text")))
+
+	// Test: XML
+	assert.Equal(t, "text/xml; charset=utf-8", Sniff([]byte(" <?xml version=\"1.0\"?>")))
+
+	// Test: PNG
+	assert.Equal(t, "image/png", Sniff([]byte("\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0DIHDR")))
+
+	// Test: WebP with masked size field
+	assert.Equal(t, "image/webp", Sniff([]byte("RIFF\x12\x34\x56\x78WEBPVP8 ")))
+
+	// Test: MP4 ftyp box with mp4 major brand
+	assert.Equal(t, "video/mp4", Sniff([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00isommp42")))
+
+	// Test: MP4 ftyp box with compatible mp4 brand
+	assert.Equal(t, "video/mp4", Sniff([]byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00mp41isom")))
+
+	// Test: gzip archive
+	assert.Equal(t, "application/x-gzip", Sniff([]byte("\x1F\x8B\x08\x00\x00\x00")))
+
+	// Test: Plain text
+	assert.Equal(t, "text/plain; charset=utf-8", Sniff([]byte("just some words")))
+
+	// Test: Binary data
+	assert.Equal(t, "application/octet-stream", Sniff([]byte("ab\x00\x01cd")))
+
+	// Test: Only the first SniffLen bytes are considered
+	data := make([]byte, SniffLen+10)
+	for i := range data {
+		data[i] = 'a'
+	}
+	data[SniffLen+1] = 0
+	assert.Equal(t, "text/plain; charset=utf-8", Sniff(data))
+}
+
+func TestTypeByExtension(t *testing.T) {
+	// Test: Known extension, case-insensitive
+	assert.Equal(t, "video/mp4", TypeByExtension(".MP4"))
+
+	// Test: Unknown extension
+	assert.Equal(t, "", TypeByExtension(".nope"))
+
+	// Test: Registered extension
+	require.NoError(t, AddExtensionType(".webmanifest", "application/manifest+json"))
+	assert.Equal(t, "application/manifest+json", TypeByExtension(".webmanifest"))
+
+	// Test: Invalid extension without dot
+	require.Error(t, AddExtensionType("txt", "text/plain"))
+}
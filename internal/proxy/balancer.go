@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Strategy int
+
+const (
+	RoundRobin Strategy = iota
+	LeastConnections
+	// ConsistentHash maps each client to the same upstream while the pool is
+	// unchanged, keyed by Config.HashHeader or else the client IP.
+	ConsistentHash
+)
+
+func ParseStrategy(s string) (Strategy, error) {
+	switch s {
+	case "round-robin":
+		return RoundRobin, nil
+	case "least-conn":
+		return LeastConnections, nil
+	case "consistent-hash":
+		return ConsistentHash, nil
+	}
+	return 0, fmt.Errorf("unknown load balancing strategy %q", s)
+}
+
+// ringReplicas is the number of points each upstream owns on the hash ring,
+// which keeps the share of keys per upstream roughly even.
+const ringReplicas = 64
+
+type upstream struct {
+	url    *url.URL
+	active atomic.Int64
+
+	mu sync.Mutex
+	// healthy is driven by active health checks, downUntil by passive failure counting.
+	healthy   bool
+	downUntil time.Time
+	fails     int
+	checks    int
+	breaker   breakerState
+
+	passive       PassiveHealth
+	breakerConfig CircuitBreaker
+}
+
+// tryAcquire reports whether a request may be sent to u at now. The check
+// and the claim of a half-open trial happen under one lock, so only the
+// upstream a picker returns is acquired.
+func (u *upstream) tryAcquire(now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.healthy || now.Before(u.downUntil) {
+		return false
+	}
+	return u.breaker.tryAcquire(now)
+}
+
+// retryAfter estimates how long until the upstream may be picked again, or 0
+// if that depends on active health checks.
+func (u *upstream) retryAfter(now time.Time) time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.healthy {
+		return 0
+	}
+	return max(u.downUntil.Sub(now), u.breaker.openUntil.Sub(now), 0)
+}
+
+type ringPoint struct {
+	hash     uint32
+	upstream *upstream
+}
+
+type pool struct {
+	upstreams  []*upstream
+	strategy   Strategy
+	hashHeader string
+	next       atomic.Uint64
+	ring       []ringPoint
+}
+
+func newPool(upstreams []*upstream, strategy Strategy, hashHeader string) *pool {
+	p := &pool{upstreams: upstreams, strategy: strategy, hashHeader: hashHeader}
+	if strategy == ConsistentHash {
+		for _, u := range upstreams {
+			for i := 0; i < ringReplicas; i++ {
+				p.ring = append(p.ring, ringPoint{hash: hashKey(u.url.String() + "#" + strconv.Itoa(i)), upstream: u})
+			}
+		}
+		sort.Slice(p.ring, func(i, j int) bool { return p.ring[i].hash < p.ring[j].hash })
+	}
+	return p
+}
+
+func hashKey(key string) uint32 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// pick returns the upstream for req, already acquired, or nil if none is
+// available.
+func (p *pool) pick(req *request.Request) *upstream {
+	now := time.Now()
+	switch p.strategy {
+	case LeastConnections:
+		return p.pickLeastConnections(now)
+	case ConsistentHash:
+		return p.pickHashed(p.hashKeyFor(req), now)
+	}
+	return p.pickRoundRobin(now)
+}
+
+func (p *pool) pickRoundRobin(now time.Time) *upstream {
+	start := p.next.Add(1)
+	for i := range p.upstreams {
+		u := p.upstreams[(start+uint64(i))%uint64(len(p.upstreams))]
+		if u.tryAcquire(now) {
+			return u
+		}
+	}
+	return nil
+}
+
+func (p *pool) pickLeastConnections(now time.Time) *upstream {
+	// Starting from a rotating offset spreads ties instead of always
+	// favouring the first upstream.
+	start := p.next.Add(1)
+	candidates := make([]*upstream, len(p.upstreams))
+	for i := range p.upstreams {
+		candidates[i] = p.upstreams[(start+uint64(i))%uint64(len(p.upstreams))]
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].active.Load() < candidates[j].active.Load()
+	})
+	for _, u := range candidates {
+		if u.tryAcquire(now) {
+			return u
+		}
+	}
+	return nil
+}
+
+func (p *pool) pickHashed(key string, now time.Time) *upstream {
+	h := hashKey(key)
+	i := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= h })
+	for n := 0; n < len(p.ring); n++ {
+		u := p.ring[(i+n)%len(p.ring)].upstream
+		if u.tryAcquire(now) {
+			return u
+		}
+	}
+	return nil
+}
+
+// retryAfter is the shortest wait until some upstream becomes available
+// again, or 0 if unknown.
+func (p *pool) retryAfter(now time.Time) time.Duration {
+	var wait time.Duration
+	for _, u := range p.upstreams {
+		if d := u.retryAfter(now); d > 0 && (wait == 0 || d < wait) {
+			wait = d
+		}
+	}
+	return wait
+}
+
+func (p *pool) hashKeyFor(req *request.Request) string {
+	if p.hashHeader != "" {
+		if v, ok := req.Headers.Get(p.hashHeader); ok {
+			return v
+		}
+	}
+	if ip, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return ip
+	}
+	return req.RemoteAddr
+}
@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"fmt"
+	"httpfromtcp/internal/request"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testUpstreams(n int) []*upstream {
+	upstreams := make([]*upstream, n)
+	for i := range upstreams {
+		u, _ := url.Parse(fmt.Sprintf("http://backend%d.internal", i))
+		upstreams[i] = &upstream{url: u, healthy: true}
+	}
+	return upstreams
+}
+
+func testRequest(t *testing.T, remoteAddr, extraHeaders string) *request.Request {
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: x\r\n" + extraHeaders + "\r\n"))
+	require.NoError(t, err)
+	req.RemoteAddr = remoteAddr
+	return req
+}
+
+func TestRoundRobin(t *testing.T) {
+	upstreams := testUpstreams(3)
+	p := newPool(upstreams, RoundRobin, "")
+	req := testRequest(t, "192.0.2.1:1000", "")
+
+	// Test: Every upstream picked once per cycle
+	seen := map[*upstream]int{}
+	for i := 0; i < 6; i++ {
+		seen[p.pick(req)]++
+	}
+	for _, u := range upstreams {
+		assert.Equal(t, 2, seen[u])
+	}
+
+	// Test: Unhealthy upstream skipped
+	upstreams[1].healthy = false
+	for i := 0; i < 6; i++ {
+		assert.NotSame(t, upstreams[1], p.pick(req))
+	}
+
+	// Test: No available upstream
+	upstreams[0].healthy = false
+	upstreams[2].downUntil = time.Now().Add(time.Minute)
+	assert.Nil(t, p.pick(req))
+}
+
+func TestLeastConnections(t *testing.T) {
+	upstreams := testUpstreams(3)
+	p := newPool(upstreams, LeastConnections, "")
+	req := testRequest(t, "192.0.2.1:1000", "")
+
+	// Test: Upstream with the fewest active requests picked
+	upstreams[0].active.Store(4)
+	upstreams[1].active.Store(1)
+	upstreams[2].active.Store(3)
+	for i := 0; i < 3; i++ {
+		assert.Same(t, upstreams[1], p.pick(req))
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	upstreams := testUpstreams(4)
+	p := newPool(upstreams, ConsistentHash, "X-User")
+
+	// Test: Same client IP always maps to the same upstream
+	first := p.pick(testRequest(t, "192.0.2.1:1000", ""))
+	for port := 1001; port < 1010; port++ {
+		assert.Same(t, first, p.pick(testRequest(t, fmt.Sprintf("192.0.2.1:%d", port), "")))
+	}
+
+	// Test: Header value takes precedence over client IP
+	byHeader := p.pick(testRequest(t, "192.0.2.1:1000", "X-User: alice\r\n"))
+	assert.Same(t, byHeader, p.pick(testRequest(t, "198.51.100.9:2000", "X-User: alice\r\n")))
+
+	// Test: Keys spread across upstreams
+	seen := map[*upstream]bool{}
+	for i := 0; i < 100; i++ {
+		seen[p.pick(testRequest(t, fmt.Sprintf("10.0.%d.%d:80", i/10, i%10), ""))] = true
+	}
+	assert.Len(t, seen, 4)
+
+	// Test: Only keys on an unhealthy upstream move
+	owner := p.pick(testRequest(t, "192.0.2.1:1000", "X-User: bob\r\n"))
+	owner.healthy = false
+	moved := p.pick(testRequest(t, "192.0.2.1:1000", "X-User: bob\r\n"))
+	assert.NotSame(t, owner, moved)
+	assert.NotNil(t, moved)
+	if owner != byHeader {
+		assert.Same(t, byHeader, p.pick(testRequest(t, "192.0.2.1:1000", "X-User: alice\r\n")))
+	}
+}
+
+func TestPassiveHealth(t *testing.T) {
+	u := testUpstreams(1)[0]
+	u.passive = PassiveHealth{MaxFails: 2, FailTimeout: time.Minute}
+
+	// Test: Success resets the failure count
+	u.recordResult(true)
+	u.recordResult(false)
+	u.recordResult(true)
+	assert.True(t, u.tryAcquire(time.Now()))
+
+	// Test: Consecutive failures take the upstream down until FailTimeout
+	u.recordResult(true)
+	assert.False(t, u.tryAcquire(time.Now()))
+	assert.True(t, u.tryAcquire(time.Now().Add(2*time.Minute)))
+}
+
+func TestActiveHealthCheck(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" && !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	p, err := NewReverseProxy(Config{
+		Upstreams:   []string{backend.URL},
+		HealthCheck: HealthCheck{Path: "/healthz", Interval: 10 * time.Millisecond, UnhealthyThreshold: 2},
+	})
+	require.NoError(t, err)
+	defer p.Close()
+	u := p.pool.upstreams[0]
+
+	// Test: Failing probes take the upstream out of rotation
+	healthy.Store(false)
+	require.Eventually(t, func() bool { return !u.tryAcquire(time.Now()) }, time.Second, 5*time.Millisecond)
+	resp := serveProxied(t, p, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	// Test: Passing probes bring it back
+	healthy.Store(true)
+	require.Eventually(t, func() bool { return u.tryAcquire(time.Now()) }, time.Second, 5*time.Millisecond)
+	resp = serveProxied(t, p, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestProxyBalancesAcrossUpstreams(t *testing.T) {
+	var hits [2]atomic.Int32
+	var backends []string
+	for i := range hits {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[i].Add(1)
+		}))
+		defer backend.Close()
+		backends = append(backends, backend.URL)
+	}
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	p, err := NewReverseProxy(Config{
+		Upstreams:     append(backends, dead.URL),
+		PassiveHealth: PassiveHealth{MaxFails: 1, FailTimeout: time.Minute},
+	})
+	require.NoError(t, err)
+
+	// Test: Dead upstream fails once, then traffic goes to the live ones
+	failures := 0
+	for i := 0; i < 9; i++ {
+		resp := serveProxied(t, p, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+		if resp.StatusCode == http.StatusBadGateway {
+			failures++
+		}
+	}
+	assert.Equal(t, 1, failures)
+	assert.Equal(t, int32(8), hits[0].Load()+hits[1].Load())
+	assert.Greater(t, hits[0].Load(), int32(2))
+	assert.Greater(t, hits[1].Load(), int32(2))
+}
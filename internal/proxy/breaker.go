@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"log"
+	"time"
+)
+
+// CircuitBreaker stops sending requests to an upstream after
+// FailureThreshold consecutive failures. Once OpenTimeout has passed a single
+// trial request is let through; its success closes the circuit again and its
+// failure reopens it. A zero FailureThreshold disables it.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+const defaultOpenTimeout = 30 * time.Second
+
+type breakerState struct {
+	failures  int
+	openUntil time.Time
+	// trial is set while the single half-open request is in flight.
+	trial bool
+}
+
+// tryAcquire reports whether the circuit admits a request at now. A
+// half-open circuit admits only the caller that claims its trial. Callers
+// hold u.mu.
+func (b *breakerState) tryAcquire(now time.Time) bool {
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if now.Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (u *upstream) recordBreaker(failed bool, now time.Time) {
+	config := u.breakerConfig
+	if config.FailureThreshold <= 0 {
+		return
+	}
+	b := &u.breaker
+	if !failed {
+		if !b.openUntil.IsZero() {
+			log.Printf("proxy: circuit for upstream %s closed", u.url.Host)
+		}
+		*b = breakerState{}
+		return
+	}
+	b.failures++
+	if b.trial || b.failures >= config.FailureThreshold {
+		openTimeout := config.OpenTimeout
+		if openTimeout == 0 {
+			openTimeout = defaultOpenTimeout
+		}
+		*b = breakerState{openUntil: now.Add(openTimeout)}
+		log.Printf("proxy: circuit for upstream %s open for %s", u.url.Host, openTimeout)
+	}
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	u := testUpstreams(1)[0]
+	u.breakerConfig = CircuitBreaker{FailureThreshold: 3, OpenTimeout: time.Minute}
+	now := time.Now()
+
+	// Test: Circuit stays closed below the threshold
+	u.recordResult(true)
+	u.recordResult(true)
+	assert.True(t, u.tryAcquire(now))
+
+	// Test: Circuit opens at the threshold
+	u.recordResult(true)
+	assert.False(t, u.tryAcquire(now))
+	assert.InDelta(t, time.Minute.Seconds(), u.retryAfter(now).Seconds(), 1)
+
+	// Test: Half-open admits a single trial request
+	later := now.Add(2 * time.Minute)
+	assert.True(t, u.tryAcquire(later))
+	assert.False(t, u.tryAcquire(later))
+
+	// Test: Failed trial reopens the circuit
+	u.recordResult(true)
+	assert.False(t, u.tryAcquire(now))
+	assert.True(t, u.tryAcquire(later))
+
+	// Test: Successful trial closes it
+	u.recordResult(false)
+	assert.True(t, u.tryAcquire(now))
+}
+
+func TestCircuitBreakerSingleTrial(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	p, err := NewReverseProxy(Config{
+		Upstreams:      []string{backend.URL},
+		CircuitBreaker: CircuitBreaker{FailureThreshold: 1, OpenTimeout: 10 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	u := p.pool.upstreams[0]
+	u.recordResult(true)
+	time.Sleep(20 * time.Millisecond)
+
+	// Test: Concurrent requests after the circuit half-opens send one trial
+	const n = 10
+	statuses := make(chan int, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			statuses <- serveProxied(t, p, "GET / HTTP/1.1\r\nHost: x\r\n\r\n").StatusCode
+		}()
+	}
+	for i := 0; i < n-1; i++ {
+		assert.Equal(t, http.StatusServiceUnavailable, <-statuses)
+	}
+	require.Eventually(t, func() bool { return hits.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	assert.Equal(t, http.StatusOK, <-statuses)
+	assert.Equal(t, int32(1), hits.Load())
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	// Test: Backoff doubles per retry up to the cap
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(0))
+	assert.Equal(t, 400*time.Millisecond, policy.backoff(2))
+	assert.Equal(t, time.Second, policy.backoff(4))
+	assert.Equal(t, time.Second, policy.backoff(62))
+}
+
+func TestProxyRetries(t *testing.T) {
+	var calls atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("recovered"))
+	}))
+	defer flaky.Close()
+
+	p, err := NewReverseProxy(Config{
+		Upstreams: []string{flaky.URL},
+		Retry:     RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond},
+	})
+	require.NoError(t, err)
+
+	// Test: Idempotent request retried until it succeeds
+	resp := serveProxied(t, p, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// Test: Non-idempotent request not retried, upstream status relayed
+	calls.Store(0)
+	resp = serveProxied(t, p, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 1\r\n\r\nx")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestProxyTimeoutAndOpenCircuit(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	p, err := NewReverseProxy(Config{
+		Upstreams:       []string{slow.URL},
+		ResponseTimeout: 20 * time.Millisecond,
+		CircuitBreaker:  CircuitBreaker{FailureThreshold: 1, OpenTimeout: 5 * time.Second},
+	})
+	require.NoError(t, err)
+
+	// Test: Slow upstream answered with 504
+	resp := serveProxied(t, p, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+
+	// Test: Open circuit answered with 503 and Retry-After
+	resp = serveProxied(t, p, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "5", resp.Header.Get("Retry-After"))
+}
@@ -0,0 +1,311 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var errDestinationDenied = errors.New("destination not allowed")
+
+type ForwardConfig struct {
+	// Allow and Deny list destinations as host names, "*.example.com"
+	// patterns, IP addresses or CIDR ranges. Deny wins and an empty Allow
+	// permits everything not denied. Address rules are also checked against
+	// the IP a name resolves to, so names cannot reach a denied network.
+	Allow []string
+	Deny  []string
+	// ConnectPorts lists the ports CONNECT may reach; empty means 443.
+	ConnectPorts []int
+	// Authenticate checks Basic proxy credentials; nil disables proxy authentication.
+	Authenticate func(username, password string) bool
+	Realm        string
+	DialTimeout  time.Duration
+}
+
+// ForwardProxy serves clients configured to use this server as their HTTP
+// proxy: absolute-form requests are forwarded and CONNECT opens a tunnel.
+type ForwardProxy struct {
+	allow        destinationRules
+	deny         destinationRules
+	connectPorts map[int]bool
+	authenticate func(username, password string) bool
+	realm        string
+	dialer       *net.Dialer
+	transport    http.RoundTripper
+}
+
+func NewForwardProxy(config ForwardConfig) (*ForwardProxy, error) {
+	allow, err := parseDestinationRules(config.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseDestinationRules(config.Deny)
+	if err != nil {
+		return nil, err
+	}
+	p := &ForwardProxy{
+		allow:        allow,
+		deny:         deny,
+		connectPorts: map[int]bool{},
+		authenticate: config.Authenticate,
+		realm:        config.Realm,
+	}
+	if len(config.ConnectPorts) == 0 {
+		config.ConnectPorts = []int{443}
+	}
+	for _, port := range config.ConnectPorts {
+		p.connectPorts[port] = true
+	}
+	if p.realm == "" {
+		p.realm = "proxy"
+	}
+	p.dialer = &net.Dialer{Timeout: config.DialTimeout, ControlContext: p.checkAddress}
+	p.transport = &http.Transport{
+		DialContext:        p.dialer.DialContext,
+		DisableCompression: true,
+	}
+	return p, nil
+}
+
+// IsAbsoluteForm reports whether req targets a full URL, as requests to a
+// forward proxy do.
+func IsAbsoluteForm(req *request.Request) bool {
+	target := strings.ToLower(req.RequestLine.RequestTarget)
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+// ForwardRequests sends absolute-form and CONNECT requests to p and everything
+// else to next. It belongs outside any caching middleware, so proxy
+// authentication and destination rules are checked for every request.
+func ForwardRequests(next server.Handler, p *ForwardProxy) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.Method == "CONNECT" || IsAbsoluteForm(req) {
+			p.Handle(w, req)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// Handle forwards an absolute-form request such as
+// "GET http://example.com/ HTTP/1.1" to its origin and serves CONNECT by
+// hijacking the connection for a tunnel.
+func (p *ForwardProxy) Handle(w *response.Writer, req *request.Request) {
+	if !p.authorized(w, req) {
+		return
+	}
+	if req.RequestLine.Method == "CONNECT" {
+		p.tunnel(w, req, w.Hijack)
+		return
+	}
+	target, err := url.Parse(req.RequestLine.RequestTarget)
+	if err != nil || target.Scheme != "http" || target.Host == "" {
+		response.Error(w, response.StatusCodeBadRequest, "forward proxy only accepts absolute http:// targets")
+		return
+	}
+	ctx, ok := p.permitted(target.Hostname())
+	if !ok {
+		response.Error(w, response.StatusCodeForbidden, "")
+		return
+	}
+	outReq, err := newOutgoingRequest(req, target.String())
+	if err != nil {
+		response.Error(w, response.StatusCodeBadRequest, err.Error())
+		return
+	}
+	resp, err := p.transport.RoundTrip(outReq.WithContext(ctx))
+	if err != nil {
+		p.dialError(w, target.Host, err)
+		return
+	}
+	defer resp.Body.Close()
+	relayResponse(w, resp)
+}
+
+// tunnel relays bytes between the client and the requested host:port, taking
+// the client connection once the tunnel is established.
+func (p *ForwardProxy) tunnel(w *response.Writer, req *request.Request, takeConn func() (net.Conn, []byte, error)) {
+	authority := req.RequestLine.RequestTarget
+	host, portStr, err := net.SplitHostPort(authority)
+	port, portErr := strconv.Atoi(portStr)
+	if err != nil || portErr != nil || host == "" {
+		response.Error(w, response.StatusCodeBadRequest, "CONNECT target must be host:port")
+		return
+	}
+	ctx, ok := p.permitted(host)
+	if !ok || !p.connectPorts[port] {
+		response.Error(w, response.StatusCodeForbidden, "")
+		return
+	}
+	upstream, err := p.dialer.DialContext(ctx, "tcp", authority)
+	if err != nil {
+		p.dialError(w, authority, err)
+		return
+	}
+	defer upstream.Close()
+	if err := w.WriteConnectEstablished(); err != nil {
+		return
+	}
+	conn, buffered, err := takeConn()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if len(buffered) > 0 {
+		if _, err := upstream.Write(buffered); err != nil {
+			return
+		}
+	}
+
+	done := make(chan struct{}, 2)
+	relay := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+		done <- struct{}{}
+	}
+	go relay(upstream, conn)
+	go relay(conn, upstream)
+	<-done
+	<-done
+}
+
+// authorized checks Basic credentials in Proxy-Authorization, answering 407
+// when they are missing or wrong.
+func (p *ForwardProxy) authorized(w *response.Writer, req *request.Request) bool {
+	if p.authenticate == nil {
+		return true
+	}
+	if value, ok := req.Headers.Get("Proxy-Authorization"); ok {
+		scheme, credentials, _ := strings.Cut(value, " ")
+		if strings.EqualFold(scheme, "Basic") {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(credentials))
+			if err == nil {
+				username, password, _ := strings.Cut(string(decoded), ":")
+				if p.authenticate(username, password) {
+					return true
+				}
+			}
+		}
+	}
+	w.Header().Override("Proxy-Authenticate", fmt.Sprintf("Basic realm=%q", p.realm))
+	response.Error(w, response.StatusCodeProxyAuthRequired, "")
+	return false
+}
+
+type allowedByNameKey struct{}
+
+// permitted applies the name rules to host. The returned context carries the
+// outcome to checkAddress, which applies the address rules when dialing.
+func (p *ForwardProxy) permitted(host string) (context.Context, bool) {
+	if p.deny.matchName(host) {
+		return nil, false
+	}
+	allowedByName := p.allow.empty() || p.allow.matchName(host)
+	if !allowedByName && len(p.allow.nets) == 0 {
+		return nil, false
+	}
+	return context.WithValue(context.Background(), allowedByNameKey{}, allowedByName), true
+}
+
+func (p *ForwardProxy) checkAddress(ctx context.Context, network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if p.deny.matchIP(ip) {
+		return fmt.Errorf("%w: %s", errDestinationDenied, ip)
+	}
+	if allowedByName, _ := ctx.Value(allowedByNameKey{}).(bool); !allowedByName && !p.allow.matchIP(ip) {
+		return fmt.Errorf("%w: %s", errDestinationDenied, ip)
+	}
+	return nil
+}
+
+func (p *ForwardProxy) dialError(w *response.Writer, target string, err error) {
+	log.Printf("proxy: forwarding to %s failed: %v", target, err)
+	switch {
+	case errors.Is(err, errDestinationDenied):
+		response.Error(w, response.StatusCodeForbidden, "")
+	case isTimeout(err):
+		response.Error(w, response.StatusCodeGatewayTimeout, "")
+	default:
+		response.Error(w, response.StatusCodeBadGateway, "")
+	}
+}
+
+type destinationRules struct {
+	names []string
+	nets  []*net.IPNet
+}
+
+func parseDestinationRules(entries []string) (destinationRules, error) {
+	var rules destinationRules
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case strings.Contains(entry, "/"):
+			_, ipNet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return rules, fmt.Errorf("invalid destination range %q: %s", entry, err)
+			}
+			rules.nets = append(rules.nets, ipNet)
+		case net.ParseIP(entry) != nil:
+			ip := net.ParseIP(entry)
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			rules.nets = append(rules.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		default:
+			rules.names = append(rules.names, entry)
+		}
+	}
+	return rules, nil
+}
+
+func (r destinationRules) empty() bool {
+	return len(r.names) == 0 && len(r.nets) == 0
+}
+
+func (r destinationRules) matchName(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, name := range r.names {
+		if suffix, ok := strings.CutPrefix(name, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r destinationRules) matchIP(ip net.IP) bool {
+	for _, ipNet := range r.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"httpfromtcp/internal/cache"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDestinationRules(t *testing.T) {
+	rules, err := parseDestinationRules([]string{"example.com", "*.internal.test", "10.0.0.0/8", "192.0.2.1"})
+	require.NoError(t, err)
+
+	// Test: Exact and wildcard names
+	assert.True(t, rules.matchName("example.com"))
+	assert.True(t, rules.matchName("EXAMPLE.com."))
+	assert.False(t, rules.matchName("www.example.com"))
+	assert.True(t, rules.matchName("db.internal.test"))
+	assert.False(t, rules.matchName("internal.test"))
+
+	// Test: Ranges and single addresses
+	assert.True(t, rules.matchIP(net.ParseIP("10.1.2.3")))
+	assert.True(t, rules.matchIP(net.ParseIP("192.0.2.1")))
+	assert.False(t, rules.matchIP(net.ParseIP("192.0.2.2")))
+
+	// Test: Invalid range rejected
+	_, err = parseDestinationRules([]string{"10.0.0.0/99"})
+	require.Error(t, err)
+}
+
+func newForwardRequest(t *testing.T, raw string) *request.Request {
+	req, err := request.RequestFromReaderWithConfig(strings.NewReader(raw), request.ParserConfig{})
+	require.NoError(t, err)
+	req.RemoteAddr = "192.0.2.7:40000"
+	return req
+}
+
+func TestForwardProxyHandle(t *testing.T) {
+	var gotAuth, gotPath string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Proxy-Authorization")
+		gotPath = r.URL.RequestURI()
+		w.Write([]byte("from origin"))
+	}))
+	defer origin.Close()
+	originURL, _ := url.Parse(origin.URL)
+
+	p, err := NewForwardProxy(ForwardConfig{
+		Allow:        []string{"127.0.0.1"},
+		Authenticate: func(user, pass string) bool { return user == "alice" && pass == "secret" },
+	})
+	require.NoError(t, err)
+	credentials := base64.StdEncoding.EncodeToString([]byte("alice:secret"))
+
+	// Test: Missing credentials answered with 407
+	resp := serveForward(t, p, "GET "+origin.URL+"/x HTTP/1.1\r\nHost: "+originURL.Host+"\r\n\r\n")
+	assert.Equal(t, http.StatusProxyAuthRequired, resp.StatusCode)
+	assert.Equal(t, `Basic realm="proxy"`, resp.Header.Get("Proxy-Authenticate"))
+
+	// Test: Absolute-form request forwarded without proxy credentials
+	resp = serveForward(t, p, "GET "+origin.URL+"/x?y=1 HTTP/1.1\r\nHost: "+originURL.Host+"\r\nProxy-Authorization: Basic "+credentials+"\r\n\r\n")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "from origin", string(body))
+	assert.Equal(t, "/x?y=1", gotPath)
+	assert.Empty(t, gotAuth)
+
+	// Test: Host outside the allow list is refused
+	resp = serveForward(t, p, "GET http://192.0.2.1/ HTTP/1.1\r\nHost: 192.0.2.1\r\nProxy-Authorization: Basic "+credentials+"\r\n\r\n")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Test: Deny list applies to addresses and to names resolving into them
+	p, err = NewForwardProxy(ForwardConfig{Deny: []string{"127.0.0.0/8", "::1"}})
+	require.NoError(t, err)
+	resp = serveForward(t, p, "GET "+origin.URL+"/ HTTP/1.1\r\nHost: "+originURL.Host+"\r\n\r\n")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = serveForward(t, p, "GET http://localhost:"+originURL.Port()+"/ HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestForwardRequestsBypassCache(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("cacheable"))
+	}))
+	defer origin.Close()
+	originURL, _ := url.Parse(origin.URL)
+	p, err := NewForwardProxy(ForwardConfig{
+		Authenticate: func(user, pass string) bool { return user == "alice" && pass == "secret" },
+	})
+	require.NoError(t, err)
+	local := func(w *response.Writer, req *request.Request) {
+		response.Error(w, response.StatusCodeNotFound, "")
+	}
+	chain := ForwardRequests(cache.Middleware(local, cache.Config{}), p)
+	serve := func(raw string) *http.Response {
+		var buf strings.Builder
+		w := response.NewWriter(&buf)
+		chain(w, newForwardRequest(t, raw))
+		require.NoError(t, w.Finish())
+		resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(buf.String())), nil)
+		require.NoError(t, err)
+		return resp
+	}
+	credentials := base64.StdEncoding.EncodeToString([]byte("alice:secret"))
+
+	// Test: Authenticated client fetches a cacheable response
+	resp := serve("GET " + origin.URL + "/x HTTP/1.1\r\nHost: " + originURL.Host + "\r\nProxy-Authorization: Basic " + credentials + "\r\n\r\n")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Test: Client without credentials is challenged, not served from a cache
+	resp = serve("GET " + origin.URL + "/x HTTP/1.1\r\nHost: " + originURL.Host + "\r\n\r\n")
+	assert.Equal(t, http.StatusProxyAuthRequired, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Cache-Status"))
+
+	// Test: Origin-form requests still reach next
+	resp = serve("GET /x HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func serveForward(t *testing.T, p *ForwardProxy, raw string) *http.Response {
+	req := newForwardRequest(t, raw)
+	var buf strings.Builder
+	w := response.NewWriter(&buf)
+	p.Handle(w, req)
+	require.NoError(t, w.Finish())
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(buf.String())), nil)
+	require.NoError(t, err)
+	return resp
+}
+
+func startEchoServer(t *testing.T) (net.Listener, int) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln, ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestForwardProxyTunnel(t *testing.T) {
+	_, port := startEchoServer(t)
+	authority := "127.0.0.1:" + strconv.Itoa(port)
+	p, err := NewForwardProxy(ForwardConfig{ConnectPorts: []int{port}})
+	require.NoError(t, err)
+
+	// Test: CONNECT tunnelled over the hijacked connection, buffered bytes first
+	client, proxySide := net.Pipe()
+	req := newForwardRequest(t, "CONNECT "+authority+" HTTP/1.1\r\nHost: "+authority+"\r\n\r\n")
+	go func() {
+		w := response.NewWriter(proxySide)
+		w.SetHijacker(func() (net.Conn, []byte, error) {
+			return proxySide, []byte("early "), nil
+		})
+		p.Handle(w, req)
+	}()
+	r := bufio.NewReader(client)
+	statusLine, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 Connection Established\r\n", statusLine)
+	blank, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", blank)
+
+	_, err = client.Write([]byte("data"))
+	require.NoError(t, err)
+	echoed := make([]byte, len("early data"))
+	_, err = io.ReadFull(r, echoed)
+	require.NoError(t, err)
+	assert.Equal(t, "early data", string(echoed))
+	client.Close()
+
+	// Test: Port outside ConnectPorts refused
+	resp := serveForward(t, p, "CONNECT 127.0.0.1:22 HTTP/1.1\r\nHost: x\r\n\r\n")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Test: Malformed authority rejected
+	resp = serveForward(t, p, "CONNECT example.com HTTP/1.1\r\nHost: x\r\n\r\n")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
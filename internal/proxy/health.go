@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// HealthCheck configures active probing of every upstream. A zero Interval
+// disables it.
+type HealthCheck struct {
+	// Path is requested with GET on each upstream; any 2xx or 3xx status passes.
+	Path     string
+	Interval time.Duration
+	// Timeout bounds each probe; 0 means Interval.
+	Timeout time.Duration
+	// UnhealthyThreshold and HealthyThreshold are the number of consecutive
+	// failed or passed probes needed to change state; 0 means 1.
+	UnhealthyThreshold int
+	HealthyThreshold   int
+}
+
+// PassiveHealth takes an upstream out of rotation for FailTimeout after
+// MaxFails consecutive proxied requests to it failed. A zero MaxFails
+// disables it.
+type PassiveHealth struct {
+	MaxFails    int
+	FailTimeout time.Duration
+}
+
+const defaultFailTimeout = 10 * time.Second
+
+// recordResult feeds the outcome of a proxied request into passive health
+// tracking and the circuit breaker. Connection errors, timeouts and gateway
+// statuses from the upstream count as failures.
+func (u *upstream) recordResult(failed bool) {
+	now := time.Now()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.recordBreaker(failed, now)
+	config := u.passive
+	if !failed {
+		u.fails = 0
+		return
+	}
+	u.fails++
+	if config.MaxFails > 0 && u.fails >= config.MaxFails {
+		failTimeout := config.FailTimeout
+		if failTimeout == 0 {
+			failTimeout = defaultFailTimeout
+		}
+		u.downUntil = now.Add(failTimeout)
+		u.fails = 0
+		log.Printf("proxy: upstream %s marked down for %s after %d failures", u.url.Host, failTimeout, config.MaxFails)
+	}
+}
+
+// recordCheck updates the active health state. checks counts consecutive
+// probes that disagree with the current state.
+func (u *upstream) recordCheck(passed bool, config HealthCheck) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if passed == u.healthy {
+		u.checks = 0
+		return
+	}
+	u.checks++
+	threshold := config.UnhealthyThreshold
+	if passed {
+		threshold = config.HealthyThreshold
+	}
+	if u.checks < max(threshold, 1) {
+		return
+	}
+	u.healthy = passed
+	u.checks = 0
+	if passed {
+		log.Printf("proxy: upstream %s is healthy", u.url.Host)
+	} else {
+		log.Printf("proxy: upstream %s is unhealthy", u.url.Host)
+	}
+}
+
+func (p *ReverseProxy) runHealthChecks(config HealthCheck) {
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			for _, u := range p.pool.upstreams {
+				u.recordCheck(p.probe(u, config), config)
+			}
+		}
+	}
+}
+
+func (p *ReverseProxy) probe(u *upstream, config HealthCheck) bool {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = config.Interval
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	target := *u.url
+	target.Path = singleJoiningSlash(u.url.Path, config.Path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := p.transport.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
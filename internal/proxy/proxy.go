@@ -0,0 +1,413 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hopByHopHeaders apply to a single connection and are never forwarded
+// (RFC 9110 section 7.6.1).
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+type Config struct {
+	// Upstreams are the base URLs of interchangeable backends.
+	Upstreams []string
+	// StripPrefix is removed from the request path before it is appended to the upstream URL.
+	StripPrefix string
+	Strategy    Strategy
+	// HashHeader keys ConsistentHash; requests without it hash by client IP.
+	HashHeader    string
+	HealthCheck   HealthCheck
+	PassiveHealth PassiveHealth
+	// DialTimeout bounds connecting to an upstream and ResponseTimeout the
+	// wait for its response headers; 0 means no limit. DialTimeout only
+	// applies to the default transport.
+	DialTimeout     time.Duration
+	ResponseTimeout time.Duration
+	Retry           RetryPolicy
+	CircuitBreaker  CircuitBreaker
+	// Transport sends upstream requests; nil means a transport that leaves
+	// compression and redirects to the client.
+	Transport http.RoundTripper
+}
+
+type ReverseProxy struct {
+	pool            *pool
+	stripPrefix     string
+	transport       http.RoundTripper
+	responseTimeout time.Duration
+	retry           RetryPolicy
+	healthInterval  time.Duration
+	done            chan struct{}
+	closeOnce       sync.Once
+}
+
+var errResponseTimeout = errors.New("timeout awaiting upstream response")
+
+func NewReverseProxy(config Config) (*ReverseProxy, error) {
+	if len(config.Upstreams) == 0 {
+		return nil, fmt.Errorf("no upstreams configured")
+	}
+	upstreams := make([]*upstream, 0, len(config.Upstreams))
+	for _, raw := range config.Upstreams {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream url %q: %s", raw, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("unsupported upstream scheme %q", u.Scheme)
+		}
+		upstreams = append(upstreams, &upstream{
+			url:           u,
+			healthy:       true,
+			passive:       config.PassiveHealth,
+			breakerConfig: config.CircuitBreaker,
+		})
+	}
+	transport := config.Transport
+	if transport == nil {
+		dialer := &net.Dialer{Timeout: config.DialTimeout}
+		transport = &http.Transport{
+			DialContext:        dialer.DialContext,
+			DisableCompression: true,
+		}
+	}
+	p := &ReverseProxy{
+		pool:            newPool(upstreams, config.Strategy, config.HashHeader),
+		stripPrefix:     config.StripPrefix,
+		transport:       transport,
+		responseTimeout: config.ResponseTimeout,
+		retry:           config.Retry,
+		healthInterval:  config.HealthCheck.Interval,
+		done:            make(chan struct{}),
+	}
+	if config.HealthCheck.Interval > 0 {
+		go p.runHealthChecks(config.HealthCheck)
+	}
+	return p, nil
+}
+
+// Close stops the active health checks.
+func (p *ReverseProxy) Close() error {
+	p.closeOnce.Do(func() { close(p.done) })
+	return nil
+}
+
+// Handle forwards req to an upstream. Idempotent requests are retried per
+// the RetryPolicy; when every attempt fails the client gets 502 for
+// connection errors, 504 for timeouts and 503 with Retry-After when no
+// upstream is available.
+func (p *ReverseProxy) Handle(w *response.Writer, req *request.Request) {
+	// a request that cannot be built is the client's fault, not the upstream's
+	outReq, err := p.newUpstreamRequest(req)
+	if err != nil {
+		response.Error(w, response.StatusCodeBadRequest, err.Error())
+		return
+	}
+	retries := 0
+	if req.MethodInfo().Idempotent {
+		retries = p.retry.MaxRetries
+	}
+	for attempt := 0; ; attempt++ {
+		u := p.pool.pick(req)
+		if u == nil {
+			p.unavailable(w)
+			return
+		}
+		resp, release, err := p.roundTrip(u, outReq)
+		failed := err != nil || isGatewayFailure(resp.StatusCode)
+		u.recordResult(failed)
+		if failed && attempt < retries {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			release()
+			log.Printf("proxy: retrying %s %s after attempt %d failed", req.RequestLine.Method, req.RequestLine.RequestTarget, attempt+1)
+			time.Sleep(p.retry.backoff(attempt))
+			continue
+		}
+		if err != nil {
+			release()
+			log.Printf("proxy: upstream %s failed: %v", u.url.Host, err)
+			if isTimeout(err) {
+				response.Error(w, response.StatusCodeGatewayTimeout, "")
+			} else {
+				response.Error(w, response.StatusCodeBadGateway, "")
+			}
+			return
+		}
+		relayResponse(w, resp)
+		resp.Body.Close()
+		release()
+		return
+	}
+}
+
+// roundTrip sends one attempt of outReq to u. release must be called once
+// the response body is no longer needed.
+func (p *ReverseProxy) roundTrip(u *upstream, outReq *upstreamRequest) (*http.Response, func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempt := outReq.base.Clone(ctx)
+	attempt.URL = upstreamURL(u.url, outReq.rawPath, outReq.query)
+	body, err := outReq.base.GetBody()
+	if err != nil {
+		cancel()
+		return nil, func() {}, err
+	}
+	attempt.Body = body
+	u.active.Add(1)
+	release := func() {
+		cancel()
+		u.active.Add(-1)
+	}
+
+	var timer *time.Timer
+	if p.responseTimeout > 0 {
+		timer = time.AfterFunc(p.responseTimeout, cancel)
+	}
+	resp, err := p.transport.RoundTrip(attempt)
+	if timer != nil && !timer.Stop() && err != nil {
+		err = fmt.Errorf("%w after %s: %s", errResponseTimeout, p.responseTimeout, err)
+	}
+	return resp, release, err
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, errResponseTimeout) || errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func (p *ReverseProxy) unavailable(w *response.Writer) {
+	wait := p.pool.retryAfter(time.Now())
+	if wait == 0 {
+		wait = p.healthInterval
+	}
+	if wait > 0 {
+		seconds := int((wait + time.Second - 1) / time.Second)
+		w.Header().Override("Retry-After", strconv.Itoa(seconds))
+	}
+	response.Error(w, response.StatusCodeServiceUnavailable, "")
+}
+
+func isGatewayFailure(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// upstreamRequest is a proxied request built once per client request; each
+// attempt points a clone of base at the chosen upstream.
+type upstreamRequest struct {
+	base    *http.Request
+	rawPath string
+	query   string
+}
+
+func (p *ReverseProxy) newUpstreamRequest(req *request.Request) (*upstreamRequest, error) {
+	path, query, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	// the request path is still percent-encoded; keep its escaping as sent
+	path = strings.TrimPrefix(path, p.stripPrefix)
+	if _, err := url.PathUnescape(path); err != nil {
+		return nil, fmt.Errorf("invalid request path %q: %w", path, err)
+	}
+	base, err := newOutgoingRequest(req, "")
+	if err != nil {
+		return nil, err
+	}
+	return &upstreamRequest{base: base, rawPath: path, query: query}, nil
+}
+
+// newOutgoingRequest copies req for sending to target, keeping only the
+// end-to-end headers and adding the forwarding headers.
+func newOutgoingRequest(req *request.Request, target string) (*http.Request, error) {
+	body, err := req.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+	outReq, err := http.NewRequest(req.RequestLine.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	outReq.ContentLength = int64(len(body))
+	connectionTokens := connectionTokens(req.Headers)
+	for key, value := range req.Headers {
+		if isHopByHop(key, connectionTokens) || strings.EqualFold(key, "Host") || strings.EqualFold(key, "Content-Length") {
+			continue
+		}
+		outReq.Header.Set(key, value)
+	}
+	if te, ok := req.Headers.Get("TE"); ok && strings.Contains(strings.ToLower(te), "trailers") {
+		outReq.Header.Set("TE", "trailers")
+	}
+	addForwardingHeaders(outReq, req)
+	return outReq, nil
+}
+
+func upstreamURL(upstream *url.URL, rawPath, query string) *url.URL {
+	u := *upstream
+	u.RawPath = singleJoiningSlash(upstream.EscapedPath(), rawPath)
+	// both halves were validated, so the joined path unescapes
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	u.RawQuery = query
+	return &u
+}
+
+func singleJoiningSlash(a, b string) string {
+	switch {
+	case b == "":
+		return a
+	case strings.HasSuffix(a, "/") && strings.HasPrefix(b, "/"):
+		return a + b[1:]
+	case !strings.HasSuffix(a, "/") && !strings.HasPrefix(b, "/"):
+		return a + "/" + b
+	}
+	return a + b
+}
+
+func addForwardingHeaders(outReq *http.Request, req *request.Request) {
+	clientIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		clientIP = req.RemoteAddr
+	}
+	host, _ := req.Headers.Get("Host")
+	if clientIP != "" {
+		if prior := outReq.Header.Get("X-Forwarded-For"); prior != "" {
+			outReq.Header.Set("X-Forwarded-For", prior+", "+clientIP)
+		} else {
+			outReq.Header.Set("X-Forwarded-For", clientIP)
+		}
+	}
+	if host != "" {
+		outReq.Header.Set("X-Forwarded-Host", host)
+	}
+	outReq.Header.Set("X-Forwarded-Proto", "http")
+
+	forwarded := []string{}
+	if clientIP != "" {
+		forwarded = append(forwarded, "for="+forwardedNode(clientIP))
+	}
+	if host != "" {
+		forwarded = append(forwarded, "host="+strconv.Quote(host))
+	}
+	forwarded = append(forwarded, "proto=http")
+	element := strings.Join(forwarded, ";")
+	if prior := outReq.Header.Get("Forwarded"); prior != "" {
+		element = prior + ", " + element
+	}
+	outReq.Header.Set("Forwarded", element)
+}
+
+// forwardedNode formats an IP for the Forwarded header (RFC 7239 section 6),
+// where IPv6 addresses must be bracketed and quoted.
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "\"[" + ip + "]\""
+	}
+	return ip
+}
+
+func connectionTokens(h headers.Headers) map[string]struct{} {
+	tokens := map[string]struct{}{}
+	if v, ok := h.Get("Connection"); ok {
+		for _, token := range strings.Split(v, ",") {
+			tokens[strings.ToLower(strings.TrimSpace(token))] = struct{}{}
+		}
+	}
+	return tokens
+}
+
+func isHopByHop(key string, connectionTokens map[string]struct{}) bool {
+	for _, h := range hopByHopHeaders {
+		if strings.EqualFold(key, h) {
+			return true
+		}
+	}
+	_, ok := connectionTokens[strings.ToLower(key)]
+	return ok
+}
+
+func relayResponse(w *response.Writer, resp *http.Response) {
+	h := w.Header()
+	connectionTokens := map[string]struct{}{}
+	for _, v := range resp.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			connectionTokens[strings.ToLower(strings.TrimSpace(token))] = struct{}{}
+		}
+	}
+	for key, values := range resp.Header {
+		if isHopByHop(key, connectionTokens) {
+			continue
+		}
+		if key == "Set-Cookie" {
+			// cookies must not be folded into one line (RFC 6265 section 3)
+			for _, value := range values {
+				w.AddFieldLine(key, value)
+			}
+			continue
+		}
+		h.Override(key, strings.Join(values, ", "))
+	}
+
+	// Without a Content-Length the writer picks the framing itself; announced
+	// trailers force chunked encoding so they can be relayed after the body.
+	trailerNames := make([]string, 0, len(resp.Trailer))
+	for key := range resp.Trailer {
+		if !isHopByHop(key, nil) && !strings.EqualFold(key, "Content-Length") {
+			trailerNames = append(trailerNames, key)
+		}
+	}
+	if len(trailerNames) > 0 {
+		h.Remove("Content-Length")
+		h.Override("Trailer", strings.Join(trailerNames, ", "))
+	}
+
+	if err := w.WriteStatusLine(response.StatusCode(resp.StatusCode)); err != nil {
+		log.Printf("proxy: cannot relay status %d: %v", resp.StatusCode, err)
+		return
+	}
+	if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+		log.Printf("proxy: cannot relay headers: %v", err)
+		return
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		log.Printf("proxy: error relaying body: %v", err)
+		return
+	}
+	if len(trailerNames) == 0 {
+		return
+	}
+	if _, err := w.WriteChunkedBodyDone(); err != nil {
+		return
+	}
+	trailers := headers.NewHeaders()
+	for _, key := range trailerNames {
+		if values := resp.Trailer.Values(key); len(values) > 0 {
+			trailers.Set(key, strings.Join(values, ", "))
+		}
+	}
+	if err := w.WriteTrailers(trailers); err != nil {
+		log.Printf("proxy: error relaying trailers: %v", err)
+	}
+}
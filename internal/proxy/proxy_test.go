@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveProxied(t *testing.T, proxy *ReverseProxy, raw string) *http.Response {
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	req.RemoteAddr = "192.0.2.7:51234"
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	proxy.Handle(w, req)
+	require.NoError(t, w.Finish())
+	resp, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestReverseProxy(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("X-Upstream", "yes")
+		w.Header().Add("Set-Cookie", "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+	defer upstream.Close()
+
+	proxy, err := NewReverseProxy(Config{Upstreams: []string{upstream.URL + "/base"}, StripPrefix: "/api"})
+	require.NoError(t, err)
+
+	// Test: Method, path, query, body and end-to-end headers forwarded
+	resp := serveProxied(t, proxy, "PUT /api/items/1?x=y HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Content-Length: 5\r\n"+
+		"Connection: X-Secret\r\n"+
+		"X-Secret: hop\r\n"+
+		"Proxy-Authorization: Basic abc\r\n"+
+		"X-Custom: kept\r\n"+
+		"X-Forwarded-For: 198.51.100.1\r\n"+
+		"\r\nhello")
+	require.NotNil(t, got)
+	assert.Equal(t, "PUT", got.Method)
+	assert.Equal(t, "/base/items/1", got.URL.Path)
+	assert.Equal(t, "x=y", got.URL.RawQuery)
+	assert.Equal(t, "hello", string(gotBody))
+	assert.Equal(t, "kept", got.Header.Get("X-Custom"))
+	assert.Empty(t, got.Header.Get("X-Secret"))
+	assert.Empty(t, got.Header.Get("Proxy-Authorization"))
+
+	// Test: Forwarding headers added
+	assert.Equal(t, "198.51.100.1, 192.0.2.7", got.Header.Get("X-Forwarded-For"))
+	assert.Equal(t, "example.com", got.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, `for=192.0.2.7;host="example.com";proto=http`, got.Header.Get("Forwarded"))
+
+	// Test: Upstream status, headers and body relayed, hop-by-hop stripped
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "yes", resp.Header.Get("X-Upstream"))
+	assert.Equal(t, []string{"a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT", "b=2"}, resp.Header.Values("Set-Cookie"))
+	assert.Empty(t, resp.Header.Get("Keep-Alive"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "created", string(body))
+
+	// Test: Percent-encoded path segments forwarded with their original escaping
+	serveProxied(t, proxy, "GET /api/a%20b/c%2Fd HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.Equal(t, "/base/a%20b/c%2Fd", got.URL.EscapedPath())
+	assert.Equal(t, "/base/a b/c/d", got.URL.Path)
+}
+
+func TestReverseProxyTrailers(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("streamed"))
+		w.(http.Flusher).Flush()
+		w.Header().Set("X-Checksum", "abc123")
+	}))
+	defer upstream.Close()
+
+	proxy, err := NewReverseProxy(Config{Upstreams: []string{upstream.URL}})
+	require.NoError(t, err)
+
+	// Test: Upstream trailers relayed after a chunked body
+	resp := serveProxied(t, proxy, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "streamed", string(body))
+	assert.Equal(t, "abc123", resp.Trailer.Get("X-Checksum"))
+}
+
+func TestReverseProxyErrors(t *testing.T) {
+	// Test: Invalid upstream rejected
+	_, err := NewReverseProxy(Config{Upstreams: []string{"ftp://example.com"}})
+	require.Error(t, err)
+
+	// Test: Unreachable upstream answered with 502
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstream.Close()
+	proxy, err := NewReverseProxy(Config{Upstreams: []string{upstream.URL}})
+	require.NoError(t, err)
+	resp := serveProxied(t, proxy, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	// Test: Unbuildable request is a 400 and does not count against the upstream
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer live.Close()
+	proxy, err = NewReverseProxy(Config{
+		Upstreams:      []string{live.URL},
+		PassiveHealth:  PassiveHealth{MaxFails: 1, FailTimeout: time.Minute},
+		CircuitBreaker: CircuitBreaker{FailureThreshold: 1, OpenTimeout: time.Minute},
+	})
+	require.NoError(t, err)
+	resp = serveProxied(t, proxy, "GET /a%zz HTTP/1.1\r\nHost: x\r\n\r\n")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = serveProxied(t, proxy, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,20 @@
+package proxy
+
+import "time"
+
+// RetryPolicy retries idempotent requests whose attempt failed before a
+// usable response arrived. Each retry picks an upstream afresh and waits
+// Backoff, doubled per attempt and capped at MaxBackoff.
+type RetryPolicy struct {
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func (r RetryPolicy) backoff(retry int) time.Duration {
+	d := r.Backoff << retry
+	if r.MaxBackoff > 0 && (d > r.MaxBackoff || d < r.Backoff) {
+		return r.MaxBackoff
+	}
+	return d
+}
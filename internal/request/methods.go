@@ -0,0 +1,76 @@
+package request
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrMethodNotImplemented = errors.New("method not implemented")
+
+type MethodBody int
+
+const (
+	// MethodBodyUndefined means a request body has no defined semantics but is still framed and read.
+	MethodBodyUndefined MethodBody = iota
+	MethodBodyExpected
+	MethodBodyForbidden
+)
+
+type Method struct {
+	Name       string
+	Safe       bool
+	Idempotent bool
+	Body       MethodBody
+}
+
+type MethodRegistry struct {
+	mu      sync.RWMutex
+	methods map[string]Method
+}
+
+func NewMethodRegistry(methods ...Method) *MethodRegistry {
+	r := &MethodRegistry{methods: map[string]Method{}}
+	for _, m := range methods {
+		r.Register(m)
+	}
+	return r
+}
+
+var StandardMethods = []Method{
+	{Name: "GET", Safe: true, Idempotent: true, Body: MethodBodyUndefined},
+	{Name: "HEAD", Safe: true, Idempotent: true, Body: MethodBodyUndefined},
+	{Name: "POST", Body: MethodBodyExpected},
+	{Name: "PUT", Idempotent: true, Body: MethodBodyExpected},
+	{Name: "DELETE", Idempotent: true, Body: MethodBodyUndefined},
+	{Name: "CONNECT", Body: MethodBodyUndefined},
+	{Name: "OPTIONS", Safe: true, Idempotent: true, Body: MethodBodyUndefined},
+	{Name: "TRACE", Safe: true, Idempotent: true, Body: MethodBodyForbidden},
+	{Name: "PATCH", Body: MethodBodyExpected},
+}
+
+var WebDAVMethods = []Method{
+	{Name: "PROPFIND", Safe: true, Idempotent: true, Body: MethodBodyUndefined},
+	{Name: "PROPPATCH", Idempotent: true, Body: MethodBodyExpected},
+	{Name: "MKCOL", Idempotent: true, Body: MethodBodyUndefined},
+	{Name: "COPY", Idempotent: true, Body: MethodBodyUndefined},
+	{Name: "MOVE", Idempotent: true, Body: MethodBodyUndefined},
+	{Name: "LOCK", Body: MethodBodyUndefined},
+	{Name: "UNLOCK", Idempotent: true, Body: MethodBodyUndefined},
+}
+
+var QueryMethod = Method{Name: "QUERY", Safe: true, Idempotent: true, Body: MethodBodyExpected}
+
+var DefaultMethodRegistry = NewMethodRegistry(StandardMethods...)
+
+func (r *MethodRegistry) Register(m Method) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.methods[m.Name] = m
+}
+
+func (r *MethodRegistry) Lookup(name string) (Method, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.methods[name]
+	return m, ok
+}
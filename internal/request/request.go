@@ -1,20 +1,27 @@
 package request
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"httpfromtcp/internal/headers"
 	"io"
-	"regexp"
 	"strconv"
+	"strings"
 )
 
 type Request struct {
 	RequestLine RequestLine
 	Headers     headers.Headers
 	Body        []byte
-	state       requestState
+	RemoteAddr  string
+
+	state  requestState
+	config ParserConfig
+	method Method
+
+	contentLength int
+	pending       *connReader
+	sendContinue  func() error
 }
 
 type RequestLine struct {
@@ -32,51 +39,216 @@ const (
 	requestStateDone
 )
 
-const crlf = "\r\n"
 const bufferSize = 8
 
+// ParserConfig selects how closely the request line and field lines must
+// follow RFC 9112. The zero value is the strict profile.
+type ParserConfig struct {
+	AllowBareLF          bool
+	AllowExtraWhitespace bool
+	AllowTokenMethods    bool
+	AllowObsText         bool
+	// MaxBodySize rejects requests declaring a larger Content-Length; 0 means no limit.
+	MaxBodySize int
+	// Methods lists the methods the server implements; nil means DefaultMethodRegistry.
+	Methods *MethodRegistry
+}
+
+var (
+	ErrExpectationFailed = errors.New("expectation failed")
+	ErrContentTooLarge   = errors.New("content too large")
+	// ErrTransferCodingNotImplemented rejects request bodies with a
+	// Transfer-Encoding; they are not decoded, so accepting them would let
+	// the body be read as the next request.
+	ErrTransferCodingNotImplemented = errors.New("transfer-coding not implemented")
+)
+
+var StrictParserConfig = ParserConfig{}
+
+var LenientParserConfig = ParserConfig{
+	AllowBareLF:          true,
+	AllowExtraWhitespace: true,
+	AllowTokenMethods:    true,
+	AllowObsText:         true,
+}
+
+func (c ParserConfig) headerOptions() headers.ParseOptions {
+	return headers.ParseOptions{
+		AllowBareLF:          c.AllowBareLF,
+		AllowExtraWhitespace: c.AllowExtraWhitespace,
+		AllowObsText:         c.AllowObsText,
+	}
+}
+
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, bufferSize)
-	readToIndex := 0
-	req := &Request{
+	return RequestFromReaderWithConfig(reader, StrictParserConfig)
+}
+
+func RequestFromReaderWithConfig(reader io.Reader, config ParserConfig) (*Request, error) {
+	c := newConnReader(reader)
+	req := newRequest(config)
+	if err := c.parseUntil(req, requestStateDone); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// RequestFromReaderWithContinue parses the request head and, if the client
+// sent "Expect: 100-continue" and has a body to send, returns before reading
+// the body. The first call to ReadBody then invokes sendContinue before
+// reading the rest of the request from reader.
+func RequestFromReaderWithContinue(reader io.Reader, config ParserConfig, sendContinue func() error) (*Request, error) {
+	return NewReader(reader, config).ReadRequest(sendContinue)
+}
+
+// Reader parses successive requests from a single connection. Bytes read past
+// the end of one request are kept for the next, so pipelined requests are
+// returned in the order they were sent.
+type Reader struct {
+	conn   *connReader
+	config ParserConfig
+	last   *Request
+}
+
+func NewReader(reader io.Reader, config ParserConfig) *Reader {
+	return &Reader{
+		conn:   newConnReader(reader),
+		config: config,
+	}
+}
+
+// ReadRequest returns the next request on the connection, or io.EOF if the
+// client closed it cleanly between requests. See RequestFromReaderWithContinue
+// for the handling of sendContinue.
+func (rd *Reader) ReadRequest(sendContinue func() error) (*Request, error) {
+	if rd.last != nil && rd.last.BodyPending() {
+		return nil, fmt.Errorf("previous request body was never read")
+	}
+	c := rd.conn
+	req := newRequest(rd.config)
+	if err := c.parseUntil(req, requestStateParsingBody); err != nil {
+		return nil, err
+	}
+	rd.last = req
+	if req.expectsContinue() && c.readToIndex == 0 {
+		req.pending = c
+		req.sendContinue = sendContinue
+		return req, nil
+	}
+	if err := c.parseUntil(req, requestStateDone); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Buffered returns the bytes read from the connection but not yet parsed.
+func (rd *Reader) Buffered() []byte {
+	return rd.conn.buf[:rd.conn.readToIndex]
+}
+
+func newRequest(config ParserConfig) *Request {
+	return &Request{
 		state:   requestStateInitialised,
 		Headers: headers.NewHeaders(),
 		Body:    make([]byte, 0),
+		config:  config,
 	}
-	for req.state != requestStateDone {
-		if readToIndex >= len(buf) {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf)
-			buf = newBuf
-		}
-		numBytesRead, err := reader.Read(buf[readToIndex:])
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				if req.state != requestStateDone {
-					return nil, fmt.Errorf("incomplete request, in state: %d, read n bytes on EOF: %d", req.state, numBytesRead)
-				}
-				break
-			}
+}
+
+// ReadBody returns the request body, reading it from the connection first if
+// it was deferred by RequestFromReaderWithContinue.
+func (r *Request) ReadBody() ([]byte, error) {
+	if r.pending == nil {
+		return r.Body, nil
+	}
+	c := r.pending
+	r.pending = nil
+	if r.sendContinue != nil {
+		if err := r.sendContinue(); err != nil {
 			return nil, err
 		}
-		readToIndex += numBytesRead
+	}
+	if err := c.parseUntil(r, requestStateDone); err != nil {
+		return nil, err
+	}
+	return r.Body, nil
+}
+
+// Clone returns a copy of r that shares nothing with it, for handlers that
+// issue their own request based on this one. The body must have been read.
+func (r *Request) Clone() *Request {
+	clone := *r
+	clone.Headers = headers.NewHeaders()
+	for key, value := range r.Headers {
+		clone.Headers[key] = value
+	}
+	clone.Body = append([]byte(nil), r.Body...)
+	clone.pending = nil
+	clone.sendContinue = nil
+	return &clone
+}
+
+// BodyPending reports whether the body is still waiting on the connection.
+func (r *Request) BodyPending() bool {
+	return r.pending != nil
+}
+
+func (r *Request) expectsContinue() bool {
+	expect, ok := r.Headers.Get("expect")
+	if !ok || !strings.EqualFold(expect, "100-continue") {
+		return false
+	}
+	return r.contentLength > 0
+}
+
+type connReader struct {
+	reader      io.Reader
+	buf         []byte
+	readToIndex int
+}
 
-		numBytesParsed, err := req.parse(buf[:readToIndex])
+func newConnReader(reader io.Reader) *connReader {
+	return &connReader{
+		reader: reader,
+		buf:    make([]byte, bufferSize),
+	}
+}
+
+func (c *connReader) parseUntil(req *Request, until requestState) error {
+	for {
+		numBytesParsed, err := req.parse(c.buf[:c.readToIndex], until)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		copy(c.buf, c.buf[numBytesParsed:c.readToIndex])
+		c.readToIndex -= numBytesParsed
+		if req.state >= until {
+			return nil
 		}
 
-		copy(buf, buf[numBytesParsed:])
-		readToIndex -= numBytesParsed
+		if c.readToIndex >= len(c.buf) {
+			newBuf := make([]byte, len(c.buf)*2)
+			copy(newBuf, c.buf)
+			c.buf = newBuf
+		}
+		numBytesRead, err := c.reader.Read(c.buf[c.readToIndex:])
+		c.readToIndex += numBytesRead
+		if err != nil && numBytesRead == 0 {
+			if errors.Is(err, io.EOF) && req.state == requestStateInitialised && c.readToIndex == 0 {
+				return io.EOF
+			}
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("incomplete request, in state: %d, read n bytes on EOF: %d", req.state, numBytesRead)
+			}
+			return err
+		}
 	}
-
-	return req, nil
 }
 
-func (r *Request) parse(data []byte) (int, error) {
+func (r *Request) parse(data []byte, until requestState) (int, error) {
 
 	totalBytesParsed := 0
-	for r.state != requestStateDone {
+	for r.state < until {
 		n, err := r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
 			return 0, err
@@ -92,40 +264,44 @@ func (r *Request) parse(data []byte) (int, error) {
 func (r *Request) parseSingle(b []byte) (int, error) {
 	switch r.state {
 	case requestStateInitialised:
-		requestLine, n, err := parseRequestLine(b)
+		requestLine, n, err := parseRequestLine(b, r.config)
 		if err != nil {
 			return 0, err
 		}
 		if n == 0 {
 			return 0, nil
 		}
+		method, err := r.config.lookupMethod(requestLine.Method)
+		if err != nil {
+			return 0, err
+		}
 		r.RequestLine = *requestLine
+		r.method = method
 		r.state = requestStateParsingHeaders
 		return n, nil
 	case requestStateParsingHeaders:
-		n, done, err := r.Headers.Parse(b)
+		n, done, err := r.Headers.ParseWithOptions(b, r.config.headerOptions())
 		if err != nil {
 			return 0, err
 		}
 		if done {
+			if err := r.headersDone(); err != nil {
+				return 0, err
+			}
 			r.state = requestStateParsingBody
 		}
 		return n, nil
 	case requestStateParsingBody:
-		contentLengthStr, ok := r.Headers.Get("content-length")
-		if !ok {
+		remaining := r.contentLength - len(r.Body)
+		if remaining == 0 {
 			r.state = requestStateDone
-			return len(b), nil
+			return 0, nil
 		}
-		contentLen, err := strconv.Atoi(contentLengthStr)
-		if err != nil {
-			return 0, fmt.Errorf("Malformed content-length: %s", err)
+		if len(b) > remaining {
+			b = b[:remaining]
 		}
 		r.Body = append(r.Body, b...)
-		if len(r.Body) > contentLen {
-			return 0, fmt.Errorf("body length exceeds stated content-length")
-		}
-		if len(r.Body) == contentLen {
+		if len(r.Body) == r.contentLength {
 			r.state = requestStateDone
 		}
 		return len(b), nil
@@ -136,42 +312,72 @@ func (r *Request) parseSingle(b []byte) (int, error) {
 	}
 }
 
-func parseRequestLine(b []byte) (*RequestLine, int, error) {
-	idx := bytes.Index(b, []byte(crlf))
+func (r *Request) headersDone() error {
+	if te, ok := r.Headers.Get("transfer-encoding"); ok {
+		if _, hasLength := r.Headers.Get("content-length"); hasLength {
+			return fmt.Errorf("request has both Transfer-Encoding and Content-Length")
+		}
+		return fmt.Errorf("%w: %s", ErrTransferCodingNotImplemented, te)
+	}
+	if contentLengthStr, ok := r.Headers.Get("content-length"); ok {
+		contentLen, err := strconv.Atoi(contentLengthStr)
+		if err != nil || contentLen < 0 {
+			return fmt.Errorf("Malformed content-length: %s", contentLengthStr)
+		}
+		r.contentLength = contentLen
+	}
+	if r.contentLength > 0 && r.method.Body == MethodBodyForbidden {
+		return fmt.Errorf("request body is not allowed for method %s", r.method.Name)
+	}
+	if r.config.MaxBodySize > 0 && r.contentLength > r.config.MaxBodySize {
+		return fmt.Errorf("%w: %d bytes exceeds limit of %d", ErrContentTooLarge, r.contentLength, r.config.MaxBodySize)
+	}
+	if expect, ok := r.Headers.Get("expect"); ok && !strings.EqualFold(expect, "100-continue") {
+		return fmt.Errorf("%w: %s", ErrExpectationFailed, expect)
+	}
+	return nil
+}
+
+func parseRequestLine(b []byte, config ParserConfig) (*RequestLine, int, error) {
+	idx, sepLen := headers.FindLineEnd(b, config.AllowBareLF)
 	if idx == -1 {
 		return nil, 0, nil
 	}
-	parts := bytes.Split(b, []byte(crlf))
-	requestLine, err := constructRequestLine(parts)
+	requestLine, err := constructRequestLine(b[:idx], config)
 	if err != nil {
 		return nil, 0, err
 	}
-	return requestLine, idx + 2, nil
+	return requestLine, idx + sepLen, nil
 }
 
-func constructRequestLine(parts [][]byte) (*RequestLine, error) {
-	requestLineParts := bytes.Split(parts[0], []byte(" "))
+func constructRequestLine(line []byte, config ParserConfig) (*RequestLine, error) {
+	var requestLineParts []string
+	if config.AllowExtraWhitespace {
+		requestLineParts = strings.Fields(string(line))
+	} else {
+		requestLineParts = strings.Split(string(line), " ")
+	}
 
 	if len(requestLineParts) != 3 {
-		return nil, fmt.Errorf("malformed request line: %s", string(parts[0]))
+		return nil, fmt.Errorf("malformed request line: %s", string(line))
 	}
 
-	requestMethod := string(requestLineParts[0])
-	var methodRe = regexp.MustCompile(`^[A-Z]+$`)
-	if !methodRe.MatchString(requestMethod) || !isValidMethod(requestMethod) {
+	requestMethod := requestLineParts[0]
+	if !headers.IsToken(requestMethod) {
 		return nil, fmt.Errorf("request method is not valid: %s", requestMethod)
 	}
-	httpVersionAndProtocol := bytes.Split(requestLineParts[2], []byte("/"))
-	httpProtocol := string(httpVersionAndProtocol[0])
-	httpVersion := string(httpVersionAndProtocol[1])
-	if httpProtocol != "HTTP" {
+	httpProtocol, httpVersion, ok := strings.Cut(requestLineParts[2], "/")
+	if !ok || httpProtocol != "HTTP" {
 		return nil, fmt.Errorf("unsupported protocol, this service is designed for HTTP")
 	}
 	if httpVersion != "1.1" {
 		return nil, fmt.Errorf("unsupported http version used, this service only supports http 1.1")
 	}
 
-	requestTarget := string(requestLineParts[1])
+	requestTarget := requestLineParts[1]
+	if !isValidTarget(requestTarget) {
+		return nil, fmt.Errorf("request target is not valid: %q", requestTarget)
+	}
 
 	requestLine := &RequestLine{
 		HttpVersion:   httpVersion,
@@ -181,18 +387,32 @@ func constructRequestLine(parts [][]byte) (*RequestLine, error) {
 	return requestLine, nil
 }
 
-func isValidMethod(requestMethod string) bool {
-	var allowedMethods = map[string]struct{}{
-		"GET":     {},
-		"HEAD":    {},
-		"POST":    {},
-		"PUT":     {},
-		"DELETE":  {},
-		"CONNECT": {},
-		"OPTIONS": {},
-		"TRACE":   {},
-		"PATCH":   {},
-	}
-	_, ok := allowedMethods[requestMethod]
-	return ok
+func isValidTarget(requestTarget string) bool {
+	if requestTarget == "" {
+		return false
+	}
+	for i := 0; i < len(requestTarget); i++ {
+		if requestTarget[i] <= ' ' || requestTarget[i] >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func (c ParserConfig) lookupMethod(name string) (Method, error) {
+	registry := c.Methods
+	if registry == nil {
+		registry = DefaultMethodRegistry
+	}
+	if m, ok := registry.Lookup(name); ok {
+		return m, nil
+	}
+	if c.AllowTokenMethods {
+		return Method{Name: name}, nil
+	}
+	return Method{}, fmt.Errorf("%w: %s", ErrMethodNotImplemented, name)
+}
+
+func (r *Request) MethodInfo() Method {
+	return r.method
 }
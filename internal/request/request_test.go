@@ -2,6 +2,7 @@ package request
 
 import (
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -227,3 +228,249 @@ func TestBodyParse(t *testing.T) {
 	require.NotNil(t, r)
 	assert.Equal(t, "", string(r.Body))
 }
+
+func TestParserConfig(t *testing.T) {
+	// Test: Invalid bare LF in strict mode
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.1\nHost: localhost:42069\n\n",
+		numBytesPerRead: 3,
+	}
+	_, err := RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Valid bare LF in lenient mode
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\nHost: localhost:42069\n\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReaderWithConfig(reader, LenientParserConfig)
+	require.NoError(t, err)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+	assert.Equal(t, "localhost:42069", r.Headers["host"])
+
+	// Test: Invalid extra whitespace in strict mode
+	reader = &chunkReader{
+		data:            "GET  /  HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Valid extra whitespace in lenient mode
+	reader = &chunkReader{
+		data:            "GET  /coffee \tHTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReaderWithConfig(reader, LenientParserConfig)
+	require.NoError(t, err)
+	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
+
+	// Test: Valid token method in lenient mode
+	reader = &chunkReader{
+		data:            "PROPFIND /dav HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReaderWithConfig(reader, LenientParserConfig)
+	require.NoError(t, err)
+	assert.Equal(t, "PROPFIND", r.RequestLine.Method)
+
+	// Test: Invalid method characters in lenient mode
+	reader = &chunkReader{
+		data:            "GE@T / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReaderWithConfig(reader, LenientParserConfig)
+	require.Error(t, err)
+
+	// Test: Invalid version without protocol separator
+	reader = &chunkReader{
+		data:            "GET / HTTP1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestMethodRegistry(t *testing.T) {
+	// Test: Unknown method is not implemented
+	reader := &chunkReader{
+		data:            "PROPFIND /dav HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err := RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrMethodNotImplemented)
+
+	// Test: Registered extension methods
+	registry := NewMethodRegistry(StandardMethods...)
+	for _, m := range WebDAVMethods {
+		registry.Register(m)
+	}
+	registry.Register(QueryMethod)
+	reader = &chunkReader{
+		data:            "MKCOL /dav/new HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReaderWithConfig(reader, ParserConfig{Methods: registry})
+	require.NoError(t, err)
+	assert.Equal(t, "MKCOL", r.RequestLine.Method)
+	assert.True(t, r.MethodInfo().Idempotent)
+	assert.False(t, r.MethodInfo().Safe)
+
+	// Test: Method semantics from the default registry
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.True(t, r.MethodInfo().Safe)
+
+	// Test: Unregistered token methods accepted when configured
+	reader = &chunkReader{
+		data:            "X-RPC.CALL /rpc HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReaderWithConfig(reader, ParserConfig{AllowTokenMethods: true})
+	require.NoError(t, err)
+	assert.Equal(t, "X-RPC.CALL", r.MethodInfo().Name)
+	assert.False(t, r.MethodInfo().Idempotent)
+
+	// Test: Invalid body on a method that forbids one
+	reader = &chunkReader{
+		data:            "TRACE / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\n\r\nhello",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+// bodyAfterContinueReader fails if the body is read before 100 Continue was sent
+type bodyAfterContinueReader struct {
+	body         string
+	continueSent *bool
+	readEarly    bool
+}
+
+func (br *bodyAfterContinueReader) Read(p []byte) (int, error) {
+	if !*br.continueSent {
+		br.readEarly = true
+		return 0, io.ErrNoProgress
+	}
+	if br.body == "" {
+		return 0, io.EOF
+	}
+	n := copy(p, br.body)
+	br.body = br.body[n:]
+	return n, nil
+}
+
+func TestExpectContinue(t *testing.T) {
+	// Test: Body is deferred until ReadBody sends 100 Continue
+	continueSent := false
+	body := &bodyAfterContinueReader{body: "hello", continueSent: &continueSent}
+	reader := io.MultiReader(strings.NewReader("POST /upload HTTP/1.1\r\n"+
+		"Host: localhost:42069\r\n"+
+		"Expect: 100-continue\r\n"+
+		"Content-Length: 5\r\n"+
+		"\r\n"), body)
+	r, err := RequestFromReaderWithContinue(reader, StrictParserConfig, func() error {
+		continueSent = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, r.BodyPending())
+	assert.False(t, continueSent)
+	b, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.True(t, continueSent)
+	assert.False(t, body.readEarly)
+	assert.Equal(t, "hello", string(b))
+	assert.False(t, r.BodyPending())
+
+	// Test: Body already available without Expect
+	reader2 := &chunkReader{
+		data:            "POST /upload HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReaderWithContinue(reader2, StrictParserConfig, func() error {
+		t.Fatal("unexpected 100 continue")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.False(t, r.BodyPending())
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Unsupported expectation
+	reader2 = &chunkReader{
+		data:            "POST /upload HTTP/1.1\r\nExpect: teapot\r\nContent-Length: 5\r\n\r\nhello",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReaderWithContinue(reader2, StrictParserConfig, nil)
+	require.ErrorIs(t, err, ErrExpectationFailed)
+
+	// Test: Declared body too large
+	reader2 = &chunkReader{
+		data:            "POST /upload HTTP/1.1\r\nExpect: 100-continue\r\nContent-Length: 500\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReaderWithContinue(reader2, ParserConfig{MaxBodySize: 100}, nil)
+	require.ErrorIs(t, err, ErrContentTooLarge)
+}
+
+func TestReaderPipelining(t *testing.T) {
+	// Test: Pipelined requests are returned in order with bodies intact
+	reader := &chunkReader{
+		data: "POST /first HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello" +
+			"GET /second HTTP/1.1\r\nHost: localhost:42069\r\n\r\n" +
+			"PUT /third HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc",
+		numBytesPerRead: 64,
+	}
+	rd := NewReader(reader, StrictParserConfig)
+	r, err := rd.ReadRequest(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+	assert.Equal(t, "hello", string(r.Body))
+	r, err = rd.ReadRequest(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	assert.Equal(t, "", string(r.Body))
+	r, err = rd.ReadRequest(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "/third", r.RequestLine.RequestTarget)
+	assert.Equal(t, "abc", string(r.Body))
+
+	// Test: Clean EOF between requests
+	_, err = rd.ReadRequest(nil)
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Invalid EOF partway through a pipelined request
+	reader = &chunkReader{
+		data:            "GET /a HTTP/1.1\r\n\r\nGET /b HTTP/1.1\r\nHost",
+		numBytesPerRead: 5,
+	}
+	rd = NewReader(reader, StrictParserConfig)
+	_, err = rd.ReadRequest(nil)
+	require.NoError(t, err)
+	_, err = rd.ReadRequest(nil)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, io.EOF)
+}
+
+func TestTransferEncoding(t *testing.T) {
+	// Test: Transfer-Encoding is not implemented
+	reader := &chunkReader{
+		data:            "POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err := RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrTransferCodingNotImplemented)
+
+	// Test: Transfer-Encoding alongside Content-Length is malformed
+	reader = &chunkReader{
+		data:            "POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\nabc",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrTransferCodingNotImplemented)
+}
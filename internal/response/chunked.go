@@ -0,0 +1,118 @@
+package response
+
+import (
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"strings"
+)
+
+// forbiddenTrailers may not be sent as trailers because they frame the message.
+var forbiddenTrailers = map[string]struct{}{
+	"content-length":    {},
+	"transfer-encoding": {},
+	"trailer":           {},
+}
+
+func (w *Writer) declareTrailers(h headers.Headers) error {
+	declared, ok := h.Get("Trailer")
+	if !ok {
+		return nil
+	}
+	w.trailers = map[string]struct{}{}
+	for _, name := range strings.Split(declared, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := forbiddenTrailers[name]; ok {
+			return fmt.Errorf("%s cannot be declared as a trailer", name)
+		}
+		w.trailers[name] = struct{}{}
+	}
+	return nil
+}
+
+func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	if w.state != writerStateBody {
+		return 0, fmt.Errorf("cannot write body in state %d", w.state)
+	}
+	if w.pending != nil {
+		if err := w.startChunked(); err != nil {
+			return 0, err
+		}
+	}
+	if !w.chunked {
+		return 0, fmt.Errorf("cannot write chunked body without chunked transfer-encoding")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	return w.writeChunk(p)
+}
+
+func (w *Writer) writeChunk(p []byte) (int, error) {
+	chunkSize := len(p)
+	nTotal := 0
+	n, err := fmt.Fprintf(w.body, "%x\r\n", chunkSize)
+	if err != nil {
+		return nTotal, err
+	}
+	nTotal += n
+
+	n, err = w.body.Write(p)
+	w.bodyWritten += n
+	if err != nil {
+		return nTotal, err
+	}
+	nTotal += n
+
+	n, err = w.body.Write([]byte("\r\n"))
+	if err != nil {
+		return nTotal, err
+	}
+	nTotal += n
+	return nTotal, nil
+}
+
+// WriteChunkedBodyDone writes the last-chunk. The trailer section that follows
+// is written by WriteTrailers, or left empty by Finish.
+func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	if w.state != writerStateBody {
+		return 0, fmt.Errorf("cannot write body in state %d", w.state)
+	}
+	if w.pending != nil {
+		if err := w.startChunked(); err != nil {
+			return 0, err
+		}
+	}
+	if !w.chunked {
+		return 0, fmt.Errorf("cannot end chunked body without chunked transfer-encoding")
+	}
+	if err := w.closeEncoders(); err != nil {
+		return 0, err
+	}
+	defer func() { w.state = writerStateTrailers }()
+	return w.body.Write([]byte("0\r\n"))
+}
+
+// WriteTrailers writes the trailer section and ends the response. Every field
+// must have been declared in the Trailer header.
+func (w *Writer) WriteTrailers(h headers.Headers) error {
+	if w.state != writerStateTrailers {
+		return fmt.Errorf("cannot write trailers in state %d", w.state)
+	}
+	for key := range h {
+		name := strings.ToLower(key)
+		if _, ok := forbiddenTrailers[name]; ok {
+			return fmt.Errorf("%s is not allowed as a trailer", name)
+		}
+		if _, ok := w.trailers[name]; !ok {
+			return fmt.Errorf("trailer %s was not declared in the Trailer header", name)
+		}
+	}
+	defer func() { w.state = writerStateDone }()
+	return writeFieldLines(w.body, w.takeFields(h), nil)
+}
@@ -0,0 +1,183 @@
+package response
+
+import (
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A BodyFilter is consulted once the final status and headers are known, just
+// before they are sent. It may edit h and return a constructor that wraps the
+// body stream, or nil to leave the body untouched. Closing the wrapper must
+// flush everything it buffered into dst. When the handler did not frame the
+// body, filters run after the Writer has buffered it and see its
+// Content-Length if it fit the buffer. Filters are consulted for statuses
+// without a body as well, so they see every final head, but the constructor
+// they return is not used.
+type BodyFilter func(statusCode StatusCode, h headers.Headers) func(dst io.Writer) io.WriteCloser
+
+// A FieldsWriter is a filter stream that derives fields from the bytes written
+// through it, such as a digest. Fields is called after Close. The fields are
+// sent as headers when the Writer buffered the whole body and as trailers when
+// the body is chunked; with any other framing they are dropped.
+type FieldsWriter interface {
+	io.WriteCloser
+	FieldNames() []string
+	Fields() headers.Headers
+}
+
+// AddBodyFilter registers f for this response. Filters added first see the
+// handler's bytes first; later filters sit closer to the connection. It must
+// be called before the headers are written.
+func (w *Writer) AddBodyFilter(f BodyFilter) error {
+	if w.state > writerStateHeaders {
+		return fmt.Errorf("cannot add body filter in state %d", w.state)
+	}
+	w.filters = append(w.filters, f)
+	return nil
+}
+
+// AddInnerBodyFilter registers f on the handler side of every filter added so
+// far, so it sees the handler's headers and bytes before outer middleware
+// transforms them. It must be called before the headers are written.
+func (w *Writer) AddInnerBodyFilter(f BodyFilter) error {
+	if w.state > writerStateHeaders {
+		return fmt.Errorf("cannot add body filter in state %d", w.state)
+	}
+	w.filters = append([]BodyFilter{f}, w.filters...)
+	return nil
+}
+
+// framedWriter feeds filter output into the writer's framing.
+type framedWriter struct {
+	w *Writer
+}
+
+func (f framedWriter) Write(p []byte) (int, error) {
+	return f.w.writeFramed(p)
+}
+
+func (w *Writer) applyFilters(h headers.Headers) {
+	if len(w.filters) == 0 {
+		return
+	}
+	var wraps []func(io.Writer) io.WriteCloser
+	for _, f := range w.filters {
+		if wrap := f(w.status, h); wrap != nil && !w.status.HasNoBody() {
+			wraps = append(wraps, wrap)
+		}
+	}
+	var dst io.Writer = framedWriter{w}
+	for i := len(wraps) - 1; i >= 0; i-- {
+		enc := wraps[i](dst)
+		w.encoders = append(w.encoders, enc)
+		dst = enc
+	}
+	if len(w.encoders) > 0 {
+		w.encoder = dst
+	}
+}
+
+// applyPendingFilters runs the filters held back by WriteHeaders once the
+// body length is known, or -1 once it is known not to fit the buffer, and
+// passes the buffered bytes through them. The headers are sent if a filter
+// framed the response; otherwise they stay pending.
+func (w *Writer) applyPendingFilters(length int) error {
+	w.filtersPending = false
+	h := w.pending
+	declared := ""
+	if length >= 0 {
+		declared = strconv.Itoa(length)
+		h.Override("Content-Length", declared)
+	}
+	w.applyFilters(h)
+	if v, ok := h.Get("Content-Length"); ok && v == declared {
+		// left for Finish, which knows the length after the filters
+		h.Remove("Content-Length")
+	}
+	buf := w.buf
+	w.buf = nil
+	if isFramed(h) {
+		w.pending = nil
+		if err := w.sendHeaders(h); err != nil {
+			return err
+		}
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.writeFramed(buf)
+	}
+	return err
+}
+
+// closeEncoders flushes the filter chain from the handler side inwards.
+func (w *Writer) closeEncoders() error {
+	encoders := w.encoders
+	w.encoders = nil
+	w.encoder = nil
+	for i := len(encoders) - 1; i >= 0; i-- {
+		if err := encoders[i].Close(); err != nil {
+			return err
+		}
+		if fw, ok := encoders[i].(FieldsWriter); ok {
+			if w.fields == nil {
+				w.fields = headers.NewHeaders()
+			}
+			for key, value := range fw.Fields() {
+				w.fields.Override(key, value)
+			}
+		}
+	}
+	return nil
+}
+
+// declareFieldTrailers announces the fields of every FieldsWriter in the
+// Trailer header of a chunked response.
+func (w *Writer) declareFieldTrailers(h headers.Headers) {
+	for _, enc := range w.encoders {
+		fw, ok := enc.(FieldsWriter)
+		if !ok {
+			continue
+		}
+		if w.trailers == nil {
+			w.trailers = map[string]struct{}{}
+		}
+		for _, name := range fw.FieldNames() {
+			if !h.HasToken("Trailer", name) {
+				h.Set("Trailer", name)
+			}
+			w.trailers[strings.ToLower(name)] = struct{}{}
+		}
+	}
+}
+
+// takeFields returns the fields collected from FieldsWriters that were
+// declared as trailers, merged over h.
+func (w *Writer) takeFields(h headers.Headers) headers.Headers {
+	fields := w.fields
+	w.fields = nil
+	for key, value := range fields {
+		if _, ok := w.trailers[strings.ToLower(key)]; ok {
+			h.Override(key, value)
+		}
+	}
+	return h
+}
+
+func (w *Writer) flushEncoders() error {
+	for i := len(w.encoders) - 1; i >= 0; i-- {
+		if f, ok := w.encoders[i].(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package response
+
+import (
+	"errors"
+	"net"
+)
+
+var (
+	ErrNotHijackable = errors.New("connection cannot be hijacked")
+	ErrHijacked      = errors.New("connection already hijacked")
+)
+
+// A Hijacker hands over the connection a Writer writes to, along with any
+// bytes the server read from it but did not parse.
+type Hijacker func() (net.Conn, []byte, error)
+
+// SetHijacker makes the underlying connection available through Hijack. It is
+// called by the server before the handler runs.
+func (w *Writer) SetHijacker(h Hijacker) {
+	w.hijacker = h
+}
+
+// Hijack lets the handler take over the connection. A response already in
+// progress is finished first; after Hijack the Writer accepts nothing more
+// and the server neither reads from nor closes the connection, so the caller
+// must close it.
+func (w *Writer) Hijack() (net.Conn, []byte, error) {
+	if w.hijacked {
+		return nil, nil, ErrHijacked
+	}
+	if w.hijacker == nil {
+		return nil, nil, ErrNotHijackable
+	}
+	if w.state > writerStateStatusLine && w.state < writerStateDone {
+		if err := w.Finish(); err != nil {
+			return nil, nil, err
+		}
+	}
+	conn, buffered, err := w.hijacker()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	w.state = writerStateDone
+	w.closeAfter = true
+	return conn, buffered, nil
+}
+
+// Hijacked reports whether Hijack succeeded.
+func (w *Writer) Hijacked() bool {
+	return w.hijacked
+}
@@ -0,0 +1,45 @@
+package response
+
+import (
+	"fmt"
+	"io"
+)
+
+var _ io.ReaderFrom = (*Writer)(nil)
+
+// writerOnly hides ReadFrom so the fallback io.Copy does not recurse.
+type writerOnly struct {
+	io.Writer
+}
+
+// ReadFrom copies r into the body. When the body is framed by Content-Length
+// the copy is handed to the connection's own ReadFrom, so an *os.File sent
+// over a *net.TCPConn goes through sendfile/splice instead of user space.
+func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
+	if w.state < writerStateBody {
+		_, hasType := w.header.Get("Content-Type")
+		_, hasLength := w.header.Get("Content-Length")
+		if !hasType || !hasLength {
+			return io.Copy(writerOnly{w}, r)
+		}
+		if err := w.writeImplicitHead(nil); err != nil {
+			return 0, err
+		}
+	}
+	rf, ok := w.body.(io.ReaderFrom)
+	if w.state != writerStateBody || w.encoder != nil || w.pending != nil || w.chunked || w.contentLength < 0 || !ok {
+		return io.Copy(writerOnly{w}, r)
+	}
+
+	remaining := int64(w.contentLength - w.bodyWritten)
+	n, err := rf.ReadFrom(io.LimitReader(r, remaining))
+	w.bodyWritten += int(n)
+	if err != nil || n < remaining {
+		return n, err
+	}
+	var extra [1]byte
+	if m, _ := r.Read(extra[:]); m > 0 {
+		return n, fmt.Errorf("body exceeds declared content-length of %d", w.contentLength)
+	}
+	return n, nil
+}
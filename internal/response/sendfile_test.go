@@ -0,0 +1,93 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterReadFrom(t *testing.T) {
+	// Test: Content-Length body copied through ReadFrom
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Length", "5")
+	n, err := w.ReadFrom(bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.Reusable())
+	assert.Contains(t, buf.String(), "\r\n\r\nhello")
+
+	// Test: Source longer than Content-Length
+	w = NewWriter(&bytes.Buffer{})
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Length", "2")
+	_, err = w.ReadFrom(bytes.NewReader([]byte("hello")))
+	require.Error(t, err)
+
+	// Test: Unframed body falls back to buffered writes
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	n, err = w.ReadFrom(bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "content-length: 5\r\n")
+}
+
+const benchFileSize = 16 << 20
+
+func benchmarkFileBody(b *testing.B, hideFile bool) {
+	path := filepath.Join(b.TempDir(), "body.bin")
+	require.NoError(b, os.WriteFile(path, bytes.Repeat([]byte("x"), benchFileSize), 0o644))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(b, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, conn)
+		conn.Close()
+	}()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(b, err)
+	defer conn.Close()
+
+	b.SetBytes(benchFileSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(path)
+		require.NoError(b, err)
+		w := NewWriter(conn)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(benchFileSize))
+		var src io.Reader = f
+		if hideFile {
+			src = struct{ io.Reader }{f}
+		}
+		_, err = io.Copy(w, src)
+		require.NoError(b, err)
+		f.Close()
+	}
+}
+
+// BenchmarkFileBodySendfile lets the connection use sendfile for the *os.File.
+func BenchmarkFileBodySendfile(b *testing.B) {
+	benchmarkFileBody(b, false)
+}
+
+// BenchmarkFileBodyUserspaceCopy hides the *os.File so every byte is copied through user space.
+func BenchmarkFileBodyUserspaceCopy(b *testing.B) {
+	benchmarkFileBody(b, true)
+}
@@ -2,34 +2,143 @@ package response
 
 import (
 	"fmt"
+	"httpfromtcp/internal/headers"
 )
 
 type StatusCode int
 
 const (
-	StatusCodeSuccess             StatusCode = 200
-	StatusCodeBadRequest          StatusCode = 400
-	StatusCodeInternalServerError StatusCode = 500
+	StatusCodeContinue             StatusCode = 100
+	StatusCodeSwitchingProtocols   StatusCode = 101
+	StatusCodeProcessing           StatusCode = 102
+	StatusCodeEarlyHints           StatusCode = 103
+	StatusCodeSuccess              StatusCode = 200
+	StatusCodeNoContent            StatusCode = 204
+	StatusCodePartialContent       StatusCode = 206
+	StatusCodeMovedPermanently     StatusCode = 301
+	StatusCodeNotModified          StatusCode = 304
+	StatusCodeBadRequest           StatusCode = 400
+	StatusCodeForbidden            StatusCode = 403
+	StatusCodeNotFound             StatusCode = 404
+	StatusCodeMethodNotAllowed     StatusCode = 405
+	StatusCodeProxyAuthRequired    StatusCode = 407
+	StatusCodePreconditionFailed   StatusCode = 412
+	StatusCodeContentTooLarge      StatusCode = 413
+	StatusCodeUnsupportedMediaType StatusCode = 415
+	StatusCodeRangeNotSatisfiable  StatusCode = 416
+	StatusCodeExpectationFailed    StatusCode = 417
+	StatusCodeUpgradeRequired      StatusCode = 426
+	StatusCodeInternalServerError  StatusCode = 500
+	StatusCodeNotImplemented       StatusCode = 501
+	StatusCodeBadGateway           StatusCode = 502
+	StatusCodeServiceUnavailable   StatusCode = 503
+	StatusCodeGatewayTimeout       StatusCode = 504
 )
 
 func getStatusLine(statusCode StatusCode) []byte {
+	return []byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, statusCode.ReasonPhrase()))
+}
+
+func (statusCode StatusCode) ReasonPhrase() string {
 	reasonPhrase := ""
 	switch statusCode {
+	case StatusCodeContinue:
+		reasonPhrase = "Continue"
+	case StatusCodeSwitchingProtocols:
+		reasonPhrase = "Switching Protocols"
+	case StatusCodeProcessing:
+		reasonPhrase = "Processing"
+	case StatusCodeEarlyHints:
+		reasonPhrase = "Early Hints"
 	case StatusCodeSuccess:
 		reasonPhrase = "OK"
+	case StatusCodeNoContent:
+		reasonPhrase = "No Content"
+	case StatusCodePartialContent:
+		reasonPhrase = "Partial Content"
+	case StatusCodeMovedPermanently:
+		reasonPhrase = "Moved Permanently"
+	case StatusCodeNotModified:
+		reasonPhrase = "Not Modified"
 	case StatusCodeBadRequest:
 		reasonPhrase = "Bad Request"
+	case StatusCodeForbidden:
+		reasonPhrase = "Forbidden"
+	case StatusCodeNotFound:
+		reasonPhrase = "Not Found"
+	case StatusCodeMethodNotAllowed:
+		reasonPhrase = "Method Not Allowed"
+	case StatusCodeProxyAuthRequired:
+		reasonPhrase = "Proxy Authentication Required"
+	case StatusCodePreconditionFailed:
+		reasonPhrase = "Precondition Failed"
+	case StatusCodeContentTooLarge:
+		reasonPhrase = "Content Too Large"
+	case StatusCodeUnsupportedMediaType:
+		reasonPhrase = "Unsupported Media Type"
+	case StatusCodeRangeNotSatisfiable:
+		reasonPhrase = "Range Not Satisfiable"
+	case StatusCodeExpectationFailed:
+		reasonPhrase = "Expectation Failed"
+	case StatusCodeUpgradeRequired:
+		reasonPhrase = "Upgrade Required"
 	case StatusCodeInternalServerError:
 		reasonPhrase = "Internal Server Error"
+	case StatusCodeNotImplemented:
+		reasonPhrase = "Not Implemented"
+	case StatusCodeBadGateway:
+		reasonPhrase = "Bad Gateway"
+	case StatusCodeServiceUnavailable:
+		reasonPhrase = "Service Unavailable"
+	case StatusCodeGatewayTimeout:
+		reasonPhrase = "Gateway Timeout"
 	}
-	return []byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, reasonPhrase))
+	return reasonPhrase
 }
 
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 	if w.state != writerStateStatusLine {
 		return fmt.Errorf("cannot write status line in state %d", w.state)
 	}
+	if statusCode.IsInformational() && statusCode != StatusCodeSwitchingProtocols {
+		return fmt.Errorf("status %d is an interim response, use WriteInterim", statusCode)
+	}
 	defer func() { w.state = writerStateHeaders }()
+	w.status = statusCode
 	_, err := w.writer.Write(getStatusLine(statusCode))
 	return err
 }
+
+func (s StatusCode) IsInformational() bool {
+	return s >= 100 && s < 200
+}
+
+// WriteInterim sends a 1xx interim response with its own header section. Any
+// number of interim responses may precede the final status line.
+func (w *Writer) WriteInterim(statusCode StatusCode, h headers.Headers) error {
+	if w.state != writerStateStatusLine {
+		return fmt.Errorf("cannot write interim response in state %d", w.state)
+	}
+	if !statusCode.IsInformational() || statusCode == StatusCodeSwitchingProtocols {
+		return fmt.Errorf("status %d is not an interim response", statusCode)
+	}
+	_, err := w.writer.Write(getStatusLine(statusCode))
+	if err != nil {
+		return err
+	}
+	return writeFieldLines(w.writer, h, nil)
+}
+
+func (w *Writer) WriteContinue() error {
+	return w.WriteInterim(StatusCodeContinue, nil)
+}
+
+// WriteEarlyHints sends a 103 response carrying Link preload headers, e.g.
+// "</style.css>; rel=preload; as=style".
+func (w *Writer) WriteEarlyHints(links ...string) error {
+	h := headers.NewHeaders()
+	for _, link := range links {
+		h.Set("Link", link)
+	}
+	return w.WriteInterim(StatusCodeEarlyHints, h)
+}
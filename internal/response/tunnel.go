@@ -0,0 +1,23 @@
+package response
+
+import "fmt"
+
+// WriteConnectEstablished sends the 200 response to a CONNECT request. It
+// has no content and the connection carries the tunnel from then on, so the
+// headers set through Header() are sent without any framing and nothing may
+// be written after it.
+func (w *Writer) WriteConnectEstablished() error {
+	if w.state != writerStateStatusLine {
+		return fmt.Errorf("cannot write status line in state %d", w.state)
+	}
+	w.status = StatusCodeSuccess
+	w.state = writerStateDone
+	w.closeAfter = true
+	h := w.header
+	h.Remove("Content-Length")
+	h.Remove("Transfer-Encoding")
+	if _, err := w.writer.Write([]byte("HTTP/1.1 200 Connection Established\r\n")); err != nil {
+		return err
+	}
+	return writeFieldLines(w.writer, h, w.fieldLines)
+}
@@ -3,21 +3,64 @@ package response
 import (
 	"fmt"
 	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/mime"
 	"io"
+	"strconv"
 )
 
 type Writer struct {
 	writer io.Writer
+	// body receives everything after the header section; io.Discard for HEAD
+	body   io.Writer
 	state  writerState
+	header headers.Headers
+
+	status        StatusCode
+	closeAfter    bool
+	chunked       bool
+	contentLength int
+	bodyWritten   int
+
+	// pending holds headers without framing until Write knows the body size
+	pending  headers.Headers
+	buf      []byte
+	trailers map[string]struct{}
+
+	filters []BodyFilter
+	// filtersPending is set while the filters wait for the body size
+	filtersPending bool
+	encoders       []io.WriteCloser
+	encoder        io.Writer
+	// fields holds what FieldsWriters produced once the encoders were closed
+	fields headers.Headers
+
+	hijacker Hijacker
+	hijacked bool
+
+	// fieldLines are sent after the headers, one line each
+	fieldLines []field
 }
 
+var _ io.Writer = (*Writer)(nil)
+
+const bodyBufferSize = 4096
+
 func NewWriter(w io.Writer) *Writer {
 	return &Writer{
-		state:  writerStateStatusLine,
-		writer: w,
+		state:         writerStateStatusLine,
+		writer:        w,
+		body:          w,
+		header:        headers.NewHeaders(),
+		contentLength: -1,
 	}
 }
 
+// Header returns the headers that will be sent with the response. Changes made
+// after the headers have been written have no effect.
+func (w *Writer) Header() headers.Headers {
+	return w.header
+}
+
 type writerState int
 
 const (
@@ -25,6 +68,7 @@ const (
 	writerStateHeaders
 	writerStateBody
 	writerStateTrailers
+	writerStateDone
 )
 
 func (w *Writer) WriteHeaders(headers headers.Headers) error {
@@ -32,79 +76,336 @@ func (w *Writer) WriteHeaders(headers headers.Headers) error {
 		return fmt.Errorf("cannot write headers in state %d", w.state)
 	}
 	defer func() { w.state = writerStateBody }()
-	for key, value := range headers {
-		header := fmt.Sprintf("%s: %s\r\n", key, value)
-		_, err := w.writer.Write([]byte(header))
+	for key, value := range w.header {
+		if _, ok := headers[key]; !ok {
+			headers[key] = value
+		}
+	}
+	if err := w.declareTrailers(headers); err != nil {
+		return err
+	}
+	if _, ok := headers.Get("Trailer"); ok && !isFramed(headers) {
+		headers.Override("Transfer-Encoding", "chunked")
+	}
+	if !isFramed(headers) && !w.status.HasNoBody() {
+		// the body is buffered first so the filters can see its length
+		w.filtersPending = len(w.filters) > 0
+	} else {
+		w.applyFilters(headers)
+	}
+	if !isFramed(headers) && !w.status.HasNoBody() {
+		w.pending = headers
+		return nil
+	}
+	return w.sendHeaders(headers)
+}
+
+func (w *Writer) sendHeaders(h headers.Headers) error {
+	if w.closeAfter {
+		h.Override("Connection", "close")
+	}
+	if h.HasToken("Transfer-Encoding", "chunked") {
+		w.declareFieldTrailers(h)
+	}
+	w.recordFraming(h)
+	return writeFieldLines(w.writer, h, w.fieldLines)
+}
+
+// AddFieldLine sends name: value as a field line of its own, for fields such
+// as Set-Cookie whose values cannot be combined into one line (RFC 9110
+// section 5.3). It must be called before the headers are written.
+func (w *Writer) AddFieldLine(name, value string) error {
+	if w.state > writerStateHeaders {
+		return fmt.Errorf("cannot add field line in state %d", w.state)
+	}
+	w.fieldLines = append(w.fieldLines, field{name, value})
+	return nil
+}
+
+func isFramed(h headers.Headers) bool {
+	_, hasLength := h.Get("Content-Length")
+	_, hasEncoding := h.Get("Transfer-Encoding")
+	return hasLength || hasEncoding
+}
+
+// HasNoBody reports whether responses with this status never carry content.
+func (s StatusCode) HasNoBody() bool {
+	return s.IsInformational() || s == StatusCodeNoContent || s == StatusCodeNotModified
+}
+
+func (w *Writer) recordFraming(h headers.Headers) {
+	if h.HasToken("Connection", "close") {
+		w.closeAfter = true
+	}
+	if h.HasToken("Transfer-Encoding", "chunked") {
+		w.chunked = true
+	}
+	if v, ok := h.Get("Content-Length"); ok {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			w.contentLength = n
+		}
+	}
+}
+
+// OmitBody discards the message body while keeping its framing headers, as
+// required for responses to HEAD requests.
+func (w *Writer) OmitBody() {
+	w.body = io.Discard
+}
+
+// CloseAfterResponse marks the connection to be closed once this response has
+// been sent, adding "Connection: close" if the headers are not yet written.
+func (w *Writer) CloseAfterResponse() {
+	w.closeAfter = true
+}
+
+// Reusable reports whether the response was completely framed, so another
+// response may follow it on the same connection.
+func (w *Writer) Reusable() bool {
+	switch {
+	case w.closeAfter || w.state < writerStateBody:
+		return false
+	case w.pending != nil:
+		return false
+	case w.status.HasNoBody():
+		return true
+	case w.chunked:
+		return w.state == writerStateDone
+	case w.contentLength >= 0:
+		return w.bodyWritten == w.contentLength
+	}
+	return false
+}
+
+// A field is a single name: value line that is not merged into Headers.
+type field struct {
+	name, value string
+}
+
+// writeFieldLines writes h followed by the separate lines and ends the
+// field section.
+func writeFieldLines(dst io.Writer, h headers.Headers, lines []field) error {
+	fields := make([]field, 0, len(h)+len(lines))
+	for key, value := range h {
+		fields = append(fields, field{key, value})
+	}
+	for _, f := range append(fields, lines...) {
+		header := fmt.Sprintf("%s: %s\r\n", f.name, f.value)
+		_, err := dst.Write([]byte(header))
 		if err != nil {
 			return err
 		}
 	}
-	_, err := w.writer.Write([]byte("\r\n"))
+	_, err := dst.Write([]byte("\r\n"))
 	return err
 }
 
+// writeImplicitHead sends whatever part of the status line and headers the
+// handler has not written yet, defaulting to 200 and a sniffed Content-Type.
+func (w *Writer) writeImplicitHead(p []byte) error {
+	if w.state == writerStateStatusLine {
+		if err := w.WriteStatusLine(StatusCodeSuccess); err != nil {
+			return err
+		}
+	}
+	if w.state != writerStateHeaders {
+		return nil
+	}
+	if _, ok := w.header.Get("Content-Type"); !ok && len(p) > 0 && !w.status.HasNoBody() {
+		w.header.Set("Content-Type", w.sniffContentType(p))
+	}
+	return w.WriteHeaders(headers.NewHeaders())
+}
+
+// sniffContentType guesses the type of the first body write. A handler that
+// sends "X-Content-Type-Options: nosniff" opts out and the body is labelled as
+// opaque bytes instead.
+func (w *Writer) sniffContentType(p []byte) string {
+	if w.header.HasToken("X-Content-Type-Options", "nosniff") {
+		return "application/octet-stream"
+	}
+	return mime.Sniff(p)
+}
+
 func (w *Writer) WriteBody(p []byte) (int, error) {
-	if w.state != writerStateBody {
+	if w.state > writerStateBody {
 		return 0, fmt.Errorf("cannot write body in state %d", w.state)
 	}
-	defer func() { w.state = writerStateTrailers }()
-	return w.writer.Write(p)
-
+	n, err := w.Write(p)
+	if w.pending == nil && !w.chunked {
+		w.state = writerStateTrailers
+	}
+	return n, err
 }
 
-func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+// Write appends p to the body and may be called repeatedly. When the handler
+// set neither Content-Length nor Transfer-Encoding, up to bodyBufferSize bytes
+// are buffered so that Finish can send an exact Content-Length; past that the
+// response switches to chunked encoding.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.state < writerStateBody {
+		if err := w.writeImplicitHead(p); err != nil {
+			return 0, err
+		}
+	}
 	if w.state != writerStateBody {
 		return 0, fmt.Errorf("cannot write body in state %d", w.state)
 	}
-	chunkSize := len(p)
-	nTotal := 0
-	n, err := fmt.Fprintf(w.writer, "%x\r\n", chunkSize)
-	if err != nil {
-		return nTotal, err
+	if w.filtersPending && len(w.buf)+len(p) > bodyBufferSize {
+		if err := w.applyPendingFilters(-1); err != nil {
+			return 0, err
+		}
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
 	}
-	nTotal += n
+	return w.writeFramed(p)
+}
 
-	n, err = w.writer.Write(p)
-	if err != nil {
-		return nTotal, err
+func (w *Writer) writeFramed(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
 	}
-	nTotal += n
+	switch {
+	case w.pending != nil:
+		if len(w.buf)+len(p) <= bodyBufferSize {
+			w.buf = append(w.buf, p...)
+			return len(p), nil
+		}
+		if err := w.startChunked(); err != nil {
+			return 0, err
+		}
+		fallthrough
+	case w.chunked:
+		if _, err := w.writeChunk(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.contentLength >= 0 && w.bodyWritten+len(p) > w.contentLength {
+		return 0, fmt.Errorf("body exceeds declared content-length of %d", w.contentLength)
+	}
+	n, err := w.body.Write(p)
+	w.bodyWritten += n
+	return n, err
+}
 
-	n, err = w.writer.Write([]byte("\r\n"))
-	if err != nil {
-		return nTotal, err
+func (w *Writer) startChunked() error {
+	if w.filtersPending {
+		if err := w.applyPendingFilters(-1); err != nil {
+			return err
+		}
+		if w.pending == nil {
+			return nil
+		}
 	}
-	nTotal += n
-	return nTotal, nil
+	h := w.pending
+	w.pending = nil
+	h.Override("Transfer-Encoding", "chunked")
+	if err := w.sendHeaders(h); err != nil {
+		return err
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.writeChunk(buf)
+	return err
 }
 
-func (w *Writer) WriteChunkedBodyDone() (int, error) {
-	if w.state != writerStateBody {
-		return 0, fmt.Errorf("cannot write body in state %d", w.state)
+// Flush sends the headers and any buffered body immediately. If the body
+// length is not yet known the response continues with chunked encoding.
+func (w *Writer) Flush() error {
+	if w.filtersPending {
+		if err := w.applyPendingFilters(-1); err != nil {
+			return err
+		}
 	}
-	defer func() { w.state = writerStateTrailers }()
-	return w.writer.Write([]byte("0\r\n"))
+	if err := w.flushEncoders(); err != nil {
+		return err
+	}
+	if w.pending == nil {
+		return nil
+	}
+	return w.startChunked()
 }
 
-func (w *Writer) WriteTrailers(h headers.Headers) error {
-	if w.state != writerStateTrailers {
-		return fmt.Errorf("cannot write trailers in state %d", w.state)
+// Finish completes the response once the handler is done: a handler that wrote
+// nothing gets an empty 200, a buffered body is sent with its Content-Length,
+// and chunked bodies get their last-chunk and an empty trailer section.
+func (w *Writer) Finish() error {
+	if w.hijacked {
+		return nil
 	}
-	for key, value := range h {
-		trailer := fmt.Sprintf("%s: %s\r\n", key, value)
-		_, err := w.writer.Write([]byte(trailer))
-		if err != nil {
+	if w.state < writerStateBody {
+		if err := w.writeImplicitHead(nil); err != nil {
 			return err
 		}
 	}
-	_, err := w.writer.Write([]byte("\r\n\r\n"))
-	return err
+	if w.filtersPending {
+		if err := w.applyPendingFilters(len(w.buf)); err != nil {
+			return err
+		}
+	}
+	if err := w.closeEncoders(); err != nil {
+		return err
+	}
+	switch {
+	case w.pending != nil:
+		h := w.pending
+		w.pending = nil
+		h.Override("Content-Length", strconv.Itoa(len(w.buf)))
+		for key, value := range w.fields {
+			h.Override(key, value)
+		}
+		w.fields = nil
+		if err := w.sendHeaders(h); err != nil {
+			return err
+		}
+		buf := w.buf
+		w.buf = nil
+		w.state = writerStateDone
+		n, err := w.body.Write(buf)
+		w.bodyWritten += n
+		return err
+	case w.chunked && w.state == writerStateBody:
+		w.state = writerStateDone
+		if _, err := w.body.Write([]byte("0\r\n")); err != nil {
+			return err
+		}
+		return writeFieldLines(w.body, w.takeFields(headers.NewHeaders()), nil)
+	case w.chunked && w.state == writerStateTrailers:
+		w.state = writerStateDone
+		return writeFieldLines(w.body, w.takeFields(headers.NewHeaders()), nil)
+	}
+	return nil
 }
 
 func GetDefaultHeaders(contentLen int) headers.Headers {
 	headers := headers.NewHeaders()
 	headers.Set("Content-Length", fmt.Sprintf("%d", contentLen))
-	headers.Set("Connection", "close")
 	headers.Set("Content-Type", "text/plain")
 	return headers
 }
+
+// Error writes a short plain-text response for statusCode. Headers already set
+// through Header() are kept unless they describe the body.
+func Error(w *Writer, statusCode StatusCode, message string) error {
+	body := []byte(fmt.Sprintf("%d %s\n", statusCode, statusCode.ReasonPhrase()))
+	if message != "" {
+		body = []byte(message + "\n")
+	}
+	h := w.Header()
+	h.Remove("Content-Encoding")
+	h.Override("Content-Type", "text/plain; charset=utf-8")
+	h.Override("Content-Length", strconv.Itoa(len(body)))
+	if err := w.WriteStatusLine(statusCode); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
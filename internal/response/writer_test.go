@@ -0,0 +1,269 @@
+package response
+
+import (
+	"bytes"
+	"httpfromtcp/internal/headers"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteInterim(t *testing.T) {
+	// Test: Interim responses before the final response
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteInterim(StatusCodeProcessing, nil))
+	require.NoError(t, w.WriteEarlyHints("</style.css>; rel=preload; as=style"))
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	h := headers.NewHeaders()
+	h.Set("Content-Length", "2")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteBody([]byte("ok"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 102 Processing\r\n\r\n"+
+		"HTTP/1.1 103 Early Hints\r\nlink: </style.css>; rel=preload; as=style\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\ncontent-length: 2\r\n\r\nok", buf.String())
+
+	// Test: Invalid interim response after the final status line
+	require.Error(t, w.WriteInterim(StatusCodeContinue, nil))
+
+	// Test: Invalid non-1xx interim response
+	w = NewWriter(&bytes.Buffer{})
+	require.Error(t, w.WriteInterim(StatusCodeSuccess, nil))
+
+	// Test: Invalid 1xx final status line
+	require.Error(t, w.WriteStatusLine(StatusCodeContinue))
+}
+
+func TestWriterAutomaticFraming(t *testing.T) {
+	// Test: Small body buffered and sent with Content-Length
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err := w.Write([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("world"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", buf.String())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\ncontent-length: 11\r\n\r\nhello world", buf.String())
+	assert.True(t, w.Reusable())
+
+	// Test: Buffer overflow switches to chunked encoding
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	big := bytes.Repeat([]byte("a"), bodyBufferSize)
+	_, err = w.Write(big)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("b"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\ntransfer-encoding: chunked\r\n\r\n"+
+		"1000\r\n"+string(big)+"\r\n1\r\nb\r\n0\r\n\r\n", buf.String())
+	assert.True(t, w.Reusable())
+
+	// Test: Explicit flush switches to chunked encoding
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err = w.Write([]byte("tick"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\ntransfer-encoding: chunked\r\n\r\n4\r\ntick\r\n", buf.String())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\ntransfer-encoding: chunked\r\n\r\n4\r\ntick\r\n0\r\n\r\n", buf.String())
+
+	// Test: Repeated writes with a declared Content-Length
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(4)))
+	_, err = w.Write([]byte("ab"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("cd"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("e"))
+	require.Error(t, err)
+	assert.True(t, w.Reusable())
+}
+
+func TestWriterImplicitHead(t *testing.T) {
+	// Test: First write sends 200 with Header() values and sniffed Content-Type
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Header().Set("X-Request-Id", "abc")
+	_, err := w.Write([]byte("<html><body>hi</body></html>"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, buf.String(), "x-request-id: abc\r\n")
+	assert.Contains(t, buf.String(), "content-type: text/html; charset=utf-8\r\n")
+	assert.Contains(t, buf.String(), "content-length: 28\r\n")
+	assert.True(t, w.Reusable())
+
+	// Test: Explicit status line with implicit headers
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("Content-Type", "text/plain")
+	require.NoError(t, w.WriteStatusLine(StatusCodeBadRequest))
+	_, err = w.Write([]byte("nope"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "HTTP/1.1 400 Bad Request\r\n")
+	assert.Contains(t, buf.String(), "content-type: text/plain\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nnope"))
+
+	// Test: Handler that wrote nothing gets an empty response
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\ncontent-length: 0\r\n\r\n", buf.String())
+	assert.True(t, w.Reusable())
+
+	// Test: No body status gets no Content-Length
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeNoContent))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n", buf.String())
+	assert.True(t, w.Reusable())
+}
+
+func TestChunkedTrailers(t *testing.T) {
+	// Test: Declared trailers end the message with a single blank line
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n5\r\nhello\r\n0\r\nx-checksum: abc\r\n\r\n"))
+	assert.True(t, w.Reusable())
+
+	// Test: Missing WriteTrailers still terminates the message
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "5\r\nhello\r\n0\r\n\r\n"))
+
+	// Test: Missing WriteChunkedBodyDone still terminates the message
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "5\r\nhello\r\n0\r\n\r\n"))
+
+	// Test: Invalid undeclared trailer
+	w = NewWriter(&bytes.Buffer{})
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	h = headers.NewHeaders()
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers = headers.NewHeaders()
+	trailers.Set("X-Other", "abc")
+	require.Error(t, w.WriteTrailers(trailers))
+
+	// Test: Invalid framing header declared as trailer
+	w = NewWriter(&bytes.Buffer{})
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "Content-Length")
+	require.Error(t, w.WriteHeaders(h))
+}
+
+func TestWriterNoSniff(t *testing.T) {
+	// Test: nosniff disables content sniffing
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, err := w.Write([]byte("<html></html>"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "content-type: application/octet-stream\r\n")
+	assert.Contains(t, buf.String(), "x-content-type-options: nosniff\r\n")
+}
+
+func TestWriterHijack(t *testing.T) {
+	// Test: Writer without a hijacker refuses
+	w := NewWriter(&bytes.Buffer{})
+	_, _, err := w.Hijack()
+	assert.ErrorIs(t, err, ErrNotHijackable)
+
+	// Test: Response in progress is finished before the connection is handed over
+	buf := &bytes.Buffer{}
+	client, server := net.Pipe()
+	defer client.Close()
+	w = NewWriter(buf)
+	w.SetHijacker(func() (net.Conn, []byte, error) {
+		return server, []byte("rest"), nil
+	})
+	_, err = w.Write([]byte("switching"))
+	require.NoError(t, err)
+	conn, buffered, err := w.Hijack()
+	require.NoError(t, err)
+	assert.Equal(t, server, conn)
+	assert.Equal(t, "rest", string(buffered))
+	assert.True(t, w.Hijacked())
+	assert.False(t, w.Reusable())
+	assert.Contains(t, buf.String(), "content-length: 9\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nswitching"))
+
+	// Test: Writer is finished after hijacking
+	_, err = w.Write([]byte("more"))
+	assert.Error(t, err)
+	assert.NoError(t, w.Finish())
+	_, _, err = w.Hijack()
+	assert.ErrorIs(t, err, ErrHijacked)
+}
+
+func TestWriterFieldLines(t *testing.T) {
+	// Test: Field lines sent separately instead of combined
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.AddFieldLine("Set-Cookie", "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT"))
+	require.NoError(t, w.AddFieldLine("Set-Cookie", "b=2"))
+	_, err := w.Write([]byte("ok"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "Set-Cookie: a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT\r\nSet-Cookie: b=2\r\n\r\nok")
+
+	// Test: Too late once the headers are written
+	assert.Error(t, w.AddFieldLine("Set-Cookie", "c=3"))
+
+	// Test: Sent with a CONNECT response too
+	buf.Reset()
+	w = NewWriter(buf)
+	require.NoError(t, w.AddFieldLine("Set-Cookie", "d=4"))
+	require.NoError(t, w.WriteConnectEstablished())
+	assert.Equal(t, "HTTP/1.1 200 Connection Established\r\nSet-Cookie: d=4\r\n\r\n", buf.String())
+}
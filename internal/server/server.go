@@ -1,9 +1,11 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"httpfromtcp/internal/request"
 	"httpfromtcp/internal/response"
+	"io"
 	"net"
 	"sync/atomic"
 )
@@ -13,12 +15,24 @@ type Handler func(w *response.Writer, req *request.Request)
 type Server struct {
 	listener net.Listener
 	handler  Handler
+	config   Config
 	closed   atomic.Bool
 }
 
+type Config struct {
+	Port   int
+	Parser request.ParserConfig
+	// NoSniff adds "X-Content-Type-Options: nosniff" to every response.
+	NoSniff bool
+}
+
 func Serve(port int, handler Handler) (*Server, error) {
-	s := &Server{}
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	return ServeWithConfig(Config{Port: port, Parser: request.StrictParserConfig}, handler)
+}
+
+func ServeWithConfig(config Config, handler Handler) (*Server, error) {
+	s := &Server{config: config}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Port))
 	if err != nil {
 		return nil, err
 	}
@@ -54,16 +68,63 @@ func (s *Server) listen() {
 }
 
 func (s *Server) handle(conn net.Conn) {
-	defer conn.Close()
-	w := response.NewWriter(conn)
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
-		w.WriteStatusLine(response.StatusCodeBadRequest)
-		body := []byte(fmt.Sprintf("Error parsing request: %v", err))
-		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
-		w.WriteBody(body)
-		return
+	hijacked := false
+	defer func() {
+		if !hijacked {
+			conn.Close()
+		}
+	}()
+	reader := request.NewReader(conn, s.config.Parser)
+	for {
+		w := response.NewWriter(conn)
+		w.SetHijacker(func() (net.Conn, []byte, error) {
+			hijacked = true
+			return conn, append([]byte(nil), reader.Buffered()...), nil
+		})
+		req, err := reader.ReadRequest(w.WriteContinue)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			w.CloseAfterResponse()
+			w.WriteStatusLine(statusForError(err))
+			body := []byte(fmt.Sprintf("Error parsing request: %v", err))
+			w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+			w.WriteBody(body)
+			return
+		}
+		req.RemoteAddr = conn.RemoteAddr().String()
+		if req.Headers.HasToken("connection", "close") {
+			w.CloseAfterResponse()
+		}
+		if req.RequestLine.Method == "HEAD" {
+			w.OmitBody()
+		}
+		if s.config.NoSniff {
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+		}
+		s.handler(w, req)
+		if w.Hijacked() {
+			return
+		}
+		if err := w.Finish(); err != nil {
+			return
+		}
+		if req.BodyPending() || !w.Reusable() {
+			return
+		}
+	}
+}
+
+func statusForError(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, request.ErrMethodNotImplemented), errors.Is(err, request.ErrTransferCodingNotImplemented):
+		return response.StatusCodeNotImplemented
+	case errors.Is(err, request.ErrContentTooLarge):
+		return response.StatusCodeContentTooLarge
+	case errors.Is(err, request.ErrExpectationFailed):
+		return response.StatusCodeExpectationFailed
+	default:
+		return response.StatusCodeBadRequest
 	}
-	s.handler(w, req)
-	return
 }
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startTestServer(t *testing.T, config Config, handler Handler) net.Conn {
+	s, err := ServeWithConfig(config, handler)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func echoTarget(w *response.Writer, req *request.Request) {
+	body := []byte(req.RequestLine.RequestTarget)
+	w.WriteStatusLine(response.StatusCodeSuccess)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func readResponseBody(t *testing.T, r *bufio.Reader) (string, string) {
+	statusLine, err := r.ReadString('\n')
+	require.NoError(t, err)
+	contentLength := 0
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+		fmt.Sscanf(line, "content-length: %d", &contentLength)
+	}
+	body := make([]byte, contentLength)
+	_, err = io.ReadFull(r, body)
+	require.NoError(t, err)
+	return statusLine, string(body)
+}
+
+func TestPipelining(t *testing.T) {
+	// Test: Pipelined requests answered in order on one connection
+	conn := startTestServer(t, Config{}, echoTarget)
+	_, err := conn.Write([]byte("GET /one HTTP/1.1\r\nHost: x\r\n\r\n" +
+		"POST /two HTTP/1.1\r\nHost: x\r\nContent-Length: 3\r\n\r\nabc" +
+		"GET /three HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	r := bufio.NewReader(conn)
+	for _, want := range []string{"/one", "/two", "/three"} {
+		statusLine, body := readResponseBody(t, r)
+		assert.Equal(t, "HTTP/1.1 200 OK\r\n", statusLine)
+		assert.Equal(t, want, body)
+	}
+
+	// Test: Connection closed after Connection: close
+	_, err = r.ReadByte()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestErrorStatus(t *testing.T) {
+	// Test: Unknown method is answered with 501
+	conn := startTestServer(t, Config{}, echoTarget)
+	_, err := conn.Write([]byte("BREW /pot HTTP/1.1\r\nHost: x\r\n\r\n"))
+	require.NoError(t, err)
+	statusLine, _ := readResponseBody(t, bufio.NewReader(conn))
+	assert.Equal(t, "HTTP/1.1 501 Not Implemented\r\n", statusLine)
+}
+
+func TestTransferEncodingRejected(t *testing.T) {
+	// Test: Chunked request body refused instead of being read as the next request
+	conn := startTestServer(t, Config{}, echoTarget)
+	_, err := conn.Write([]byte("POST /one HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"2a\r\nGET /smuggled HTTP/1.1\r\nHost: x\r\n\r\n\r\n0\r\n\r\n" +
+		"GET /two HTTP/1.1\r\nHost: x\r\n\r\n"))
+	require.NoError(t, err)
+	r := bufio.NewReader(conn)
+	statusLine, _ := readResponseBody(t, r)
+	assert.Equal(t, "HTTP/1.1 501 Not Implemented\r\n", statusLine)
+	// closed without answering the smuggled or following request
+	_, err = r.ReadByte()
+	require.Error(t, err)
+
+	// Test: Transfer-Encoding with Content-Length is a bad request
+	conn = startTestServer(t, Config{}, echoTarget)
+	_, err = conn.Write([]byte("POST /one HTTP/1.1\r\nHost: x\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\nabc"))
+	require.NoError(t, err)
+	r = bufio.NewReader(conn)
+	statusLine, _ = readResponseBody(t, r)
+	assert.Equal(t, "HTTP/1.1 400 Bad Request\r\n", statusLine)
+	// closed without answering the smuggled or following request
+	_, err = r.ReadByte()
+	require.Error(t, err)
+}
+
+func TestEmptyHandlerResponse(t *testing.T) {
+	// Test: Handler that writes nothing still gets a complete response
+	conn := startTestServer(t, Config{}, func(w *response.Writer, req *request.Request) {})
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\nGET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+	require.NoError(t, err)
+	r := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		statusLine, body := readResponseBody(t, r)
+		assert.Equal(t, "HTTP/1.1 200 OK\r\n", statusLine)
+		assert.Equal(t, "", body)
+	}
+}
+
+func TestHijack(t *testing.T) {
+	// Test: Hijacked connection carries the unparsed bytes and stays open after the handler
+	hijack := func(w *response.Writer, req *request.Request) {
+		w.WriteConnectEstablished()
+		conn, buffered, err := w.Hijack()
+		require.NoError(t, err)
+		_, _, err = w.Hijack()
+		assert.ErrorIs(t, err, response.ErrHijacked)
+		go func() {
+			defer conn.Close()
+			more := make([]byte, 5)
+			io.ReadFull(conn, more)
+			conn.Write([]byte(req.RequestLine.RequestTarget + " " + string(buffered) + string(more)))
+		}()
+	}
+	conn := startTestServer(t, Config{}, hijack)
+	_, err := conn.Write([]byte("CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\nhello"))
+	require.NoError(t, err)
+	r := bufio.NewReader(conn)
+	statusLine, body := readResponseBody(t, r)
+	assert.Equal(t, "HTTP/1.1 200 Connection Established\r\n", statusLine)
+	assert.Equal(t, "", body)
+	_, err = conn.Write([]byte(" more"))
+	require.NoError(t, err)
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com:443 hello more", string(rest))
+}
@@ -0,0 +1,207 @@
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrClosed = errors.New("event stream closed")
+
+// Event is one server-sent event. Data may span several lines; ID and Event
+// must not contain line breaks. A zero Retry leaves the client's reconnection
+// delay unchanged.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+type Config struct {
+	// KeepAlive is the interval between comment lines that keep idle
+	// connections open and detect clients that went away; 0 means 15s and a
+	// negative value disables them.
+	KeepAlive time.Duration
+	// Retry, if set, is sent as the reconnection delay before any event.
+	Retry time.Duration
+}
+
+// Writer streams a text/event-stream response. It is safe for concurrent use.
+type Writer struct {
+	w           *response.Writer
+	lastEventID string
+
+	mu   sync.Mutex
+	err  error
+	done chan struct{}
+}
+
+// Handler opens an event stream for every request and passes it to serve.
+// The stream is closed once serve returns; HEAD requests only get the head.
+func Handler(serve func(s *Writer, req *request.Request), config Config) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		s, err := NewWriter(w, req, config)
+		if err != nil || req.RequestLine.Method == "HEAD" {
+			return
+		}
+		defer s.Close()
+		serve(s, req)
+	}
+}
+
+// NewWriter sends the response head for an event stream and starts the
+// keep-alive comments. For a HEAD request the stream is already closed, since
+// nothing written to it would reach the client.
+func NewWriter(w *response.Writer, req *request.Request, config Config) (*Writer, error) {
+	if config.KeepAlive == 0 {
+		config.KeepAlive = 15 * time.Second
+	}
+	lastEventID, _ := req.Headers.Get("Last-Event-ID")
+	s := &Writer{
+		w:           w,
+		lastEventID: lastEventID,
+		done:        make(chan struct{}),
+	}
+	h := w.Header()
+	h.Override("Content-Type", "text/event-stream")
+	h.Override("Cache-Control", "no-cache")
+	h.Remove("Content-Length")
+	if err := w.WriteStatusLine(response.StatusCodeSuccess); err != nil {
+		return nil, err
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return nil, err
+	}
+	if req.RequestLine.Method == "HEAD" {
+		if err := w.Flush(); err != nil {
+			return nil, err
+		}
+		s.end(ErrClosed)
+		return s, nil
+	}
+	var head strings.Builder
+	if config.Retry > 0 {
+		writeRetry(&head, config.Retry)
+		head.WriteString("\n")
+	}
+	if err := s.write(head.String()); err != nil {
+		return nil, err
+	}
+	if config.KeepAlive > 0 {
+		go s.keepAlive(config.KeepAlive)
+	}
+	return s, nil
+}
+
+// LastEventID returns the Last-Event-ID a reconnecting client sent, so the
+// stream can resume after that event. It is empty on a first connection.
+func (s *Writer) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done is closed once the stream ends, either because a write to the client
+// failed or because Close was called.
+func (s *Writer) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send writes e and flushes it to the client.
+func (s *Writer) Send(e Event) error {
+	if strings.ContainsAny(e.ID, "\r\n\x00") || strings.ContainsAny(e.Event, "\r\n") {
+		return fmt.Errorf("event id and type must be a single line")
+	}
+	var b strings.Builder
+	if e.ID != "" {
+		b.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Event != "" {
+		b.WriteString("event: " + e.Event + "\n")
+	}
+	if e.Retry > 0 {
+		writeRetry(&b, e.Retry)
+	}
+	data := strings.ReplaceAll(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Comment writes a comment line, which clients ignore.
+func (s *Writer) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", ""), "\n") {
+		b.WriteString(": " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Close stops the keep-alive comments and ends the stream. The response is
+// completed by the server once the handler returns.
+func (s *Writer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil
+	}
+	s.end(ErrClosed)
+	return nil
+}
+
+func (s *Writer) write(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if text == "" {
+		return s.flush()
+	}
+	if _, err := s.w.Write([]byte(text)); err != nil {
+		s.end(err)
+		return err
+	}
+	return s.flush()
+}
+
+func (s *Writer) flush() error {
+	if err := s.w.Flush(); err != nil {
+		s.end(err)
+		return err
+	}
+	return nil
+}
+
+// end records why the stream stopped; s.mu must be held.
+func (s *Writer) end(err error) {
+	s.err = err
+	close(s.done)
+}
+
+func (s *Writer) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if s.write(": keep-alive\n\n") != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeRetry(b *strings.Builder, retry time.Duration) {
+	b.WriteString("retry: " + strconv.FormatInt(retry.Milliseconds(), 10) + "\n")
+}
@@ -0,0 +1,127 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(t *testing.T, extra string) *request.Request {
+	req, err := request.RequestFromReader(strings.NewReader("GET /events HTTP/1.1\r\nHost: x\r\n" + extra + "\r\n"))
+	require.NoError(t, err)
+	return req
+}
+
+// lockedBuffer lets the test read what the keep-alive goroutine writes.
+type lockedBuffer struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	fail bool
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fail {
+		return 0, errors.New("broken pipe")
+	}
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWriterEvents(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	s, err := NewWriter(w, newRequest(t, "Last-Event-ID: 41\r\n"), Config{KeepAlive: -1, Retry: 3 * time.Second})
+	require.NoError(t, err)
+
+	// Test: Last-Event-ID available for resuming
+	assert.Equal(t, "41", s.LastEventID())
+
+	// Test: Fields written and multi-line data split
+	require.NoError(t, s.Send(Event{ID: "42", Event: "update", Data: "line one\nline two"}))
+	require.NoError(t, s.Send(Event{Data: "plain", Retry: 500 * time.Millisecond}))
+	require.NoError(t, s.Comment("note"))
+	assert.Error(t, s.Send(Event{ID: "4\n2"}))
+	require.NoError(t, s.Close())
+	assert.ErrorIs(t, s.Send(Event{Data: "late"}), ErrClosed)
+	require.NoError(t, w.Finish())
+
+	resp, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "retry: 3000\n\n"+
+		"id: 42\nevent: update\ndata: line one\ndata: line two\n\n"+
+		"retry: 500\ndata: plain\n\n"+
+		": note\n\n", string(body))
+}
+
+func TestWriterKeepAlive(t *testing.T) {
+	buf := &lockedBuffer{}
+	s, err := NewWriter(response.NewWriter(buf), newRequest(t, ""), Config{KeepAlive: 5 * time.Millisecond})
+	require.NoError(t, err)
+
+	// Test: Idle stream receives keep-alive comments
+	require.Eventually(t, func() bool {
+		return strings.Contains(buf.String(), ": keep-alive\n\n")
+	}, time.Second, 5*time.Millisecond)
+
+	// Test: Failed write to a departed client ends the stream
+	buf.mu.Lock()
+	buf.fail = true
+	buf.mu.Unlock()
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stream did not stop after the client went away")
+	}
+	assert.Error(t, s.Send(Event{Data: "gone"}))
+}
+
+func TestWriterHead(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	w.OmitBody()
+	req, err := request.RequestFromReader(strings.NewReader("HEAD /events HTTP/1.1\r\nHost: x\r\n\r\n"))
+	require.NoError(t, err)
+	served := false
+	Handler(func(s *Writer, req *request.Request) { served = true }, Config{})(w, req)
+	require.NoError(t, w.Finish())
+
+	// Test: HEAD gets the stream's head without running serve
+	assert.False(t, served)
+	resp, err := http.ReadResponse(bufio.NewReader(buf), &http.Request{Method: "HEAD"})
+	require.NoError(t, err)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+
+	// Test: Stream opened directly for HEAD is already done
+	s, err := NewWriter(response.NewWriter(&bytes.Buffer{}), req, Config{})
+	require.NoError(t, err)
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("HEAD stream not done")
+	}
+	assert.ErrorIs(t, s.Send(Event{Data: "x"}), ErrClosed)
+}
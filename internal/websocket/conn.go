@@ -0,0 +1,325 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Close codes from RFC 6455 section 7.4.1 and the IANA WebSocket Close Code
+// Number Registry.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseAbnormal        = 1006
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+	CloseServiceRestart  = 1012
+	CloseTryAgainLater   = 1013
+	CloseBadGateway      = 1014
+)
+
+var ErrClosed = errors.New("websocket closed")
+
+// CloseError ends a connection: either the peer's close frame, or the reason
+// this side failed the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("websocket closed with code %d: %s", e.Code, e.Reason)
+}
+
+// Conn is one end of a WebSocket connection. One goroutine may read while
+// others write; writes are serialised.
+type Conn struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	client      bool
+	config      Config
+	subprotocol string
+	compress    bool
+
+	readMu  sync.Mutex
+	readErr error
+
+	writeMu   sync.Mutex
+	closeSent bool
+
+	pongHandler func(data []byte)
+}
+
+func newConn(conn net.Conn, buffered []byte, client bool, config Config) *Conn {
+	return &Conn{
+		conn:   conn,
+		reader: bufio.NewReader(io.MultiReader(bytes.NewReader(buffered), conn)),
+		client: client,
+		config: config.withDefaults(),
+	}
+}
+
+// Subprotocol returns the negotiated Sec-WebSocket-Protocol, if any.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// SetPongHandler registers f to receive the payload of every pong. It must be
+// set before reading starts.
+func (c *Conn) SetPongHandler(f func(data []byte)) {
+	c.pongHandler = f
+}
+
+// SetReadDeadline bounds how long ReadMessage waits for the next frame.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// ReadMessage returns the next text or binary message, reassembling fragments
+// and answering pings and close frames along the way. Once it returns an error
+// the connection is closed; a *CloseError carries the close code.
+func (c *Conn) ReadMessage() (Opcode, []byte, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	op, data, err := c.readMessage()
+	if err != nil {
+		c.readErr = err
+		c.conn.Close()
+	}
+	return op, data, err
+}
+
+func (c *Conn) readMessage() (Opcode, []byte, error) {
+	var op Opcode
+	var data []byte
+	started, compressed := false, false
+	for {
+		f, err := readFrame(c.reader, !c.client, c.config.MaxMessageSize-len(data))
+		if err != nil {
+			return 0, nil, c.readFailed(err)
+		}
+		if f.rsv1 && (!c.compress || f.opcode.isControl() || f.opcode == OpContinuation) {
+			return 0, nil, c.fail(CloseProtocolError, "unexpected compressed frame")
+		}
+		switch {
+		case f.opcode.isControl():
+			if err := c.handleControl(f); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case f.opcode == OpContinuation:
+			if !started {
+				return 0, nil, c.fail(CloseProtocolError, "continuation without a message")
+			}
+		case f.opcode == OpText || f.opcode == OpBinary:
+			if started {
+				return 0, nil, c.fail(CloseProtocolError, "new message before the last one finished")
+			}
+			started, op, compressed = true, f.opcode, f.rsv1
+		default:
+			return 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", f.opcode))
+		}
+		data = append(data, f.payload...)
+		if !f.fin {
+			continue
+		}
+		if compressed {
+			if data, err = inflate(data, c.config.MaxMessageSize); err != nil {
+				return 0, nil, c.readFailed(err)
+			}
+		}
+		if op == OpText && !utf8.Valid(data) {
+			return 0, nil, c.fail(CloseInvalidPayload, "text message is not valid UTF-8")
+		}
+		return op, data, nil
+	}
+}
+
+// readFailed fails the connection for protocol violations and reports a peer
+// that went away without a close frame as CloseAbnormal.
+func (c *Conn) readFailed(err error) error {
+	var closeErr *CloseError
+	if errors.As(err, &closeErr) {
+		return c.fail(closeErr.Code, closeErr.Reason)
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &CloseError{Code: CloseAbnormal}
+	}
+	return err
+}
+
+func (c *Conn) handleControl(f frame) error {
+	switch f.opcode {
+	case OpPing:
+		err := c.writeControl(OpPong, f.payload)
+		if errors.Is(err, ErrClosed) {
+			return nil
+		}
+		return err
+	case OpPong:
+		if c.pongHandler != nil {
+			c.pongHandler(f.payload)
+		}
+		return nil
+	case OpClose:
+		closeErr, ok := parseClosePayload(f.payload)
+		if !ok {
+			return c.fail(CloseProtocolError, "invalid close frame")
+		}
+		if !utf8.ValidString(closeErr.Reason) {
+			return c.fail(CloseInvalidPayload, "close reason is not valid UTF-8")
+		}
+		// echo the code back to complete the closing handshake
+		code := closeErr.Code
+		if code == CloseNoStatus {
+			code = 0
+		}
+		c.sendClose(code, "")
+		return closeErr
+	}
+	return c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", f.opcode))
+}
+
+func parseClosePayload(p []byte) (*CloseError, bool) {
+	if len(p) == 0 {
+		return &CloseError{Code: CloseNoStatus}, true
+	}
+	if len(p) == 1 {
+		return nil, false
+	}
+	code := int(binary.BigEndian.Uint16(p))
+	valid := (code >= 1000 && code <= 1003) || (code >= 1007 && code <= 1014) || (code >= 3000 && code <= 4999)
+	return &CloseError{Code: code, Reason: string(p[2:])}, valid
+}
+
+// fail sends a close frame for a violation and reports it as the read error.
+func (c *Conn) fail(code int, reason string) error {
+	c.sendClose(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// WriteMessage sends a text or binary message, compressing it when
+// permessage-deflate was negotiated and splitting it into frames of
+// Config.FragmentSize.
+func (c *Conn) WriteMessage(op Opcode, data []byte) error {
+	if op != OpText && op != OpBinary {
+		return fmt.Errorf("cannot send opcode %d as a message", op)
+	}
+	compressed := false
+	if c.compress && len(data) > 0 {
+		deflated, err := deflate(data, c.config.CompressionLevel)
+		if err != nil {
+			return err
+		}
+		data, compressed = deflated, true
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+	size := c.config.FragmentSize
+	if size <= 0 || size > len(data) {
+		size = len(data)
+	}
+	f := frame{opcode: op, rsv1: compressed}
+	for {
+		n := min(size, len(data))
+		f.payload, data = data[:n], data[n:]
+		f.fin = len(data) == 0
+		if err := c.writeFrameLocked(f); err != nil {
+			return err
+		}
+		if f.fin {
+			return nil
+		}
+		f.opcode, f.rsv1 = OpContinuation, false
+	}
+}
+
+// Ping sends a ping; the peer's pong reaches the pong handler.
+func (c *Conn) Ping(data []byte) error {
+	return c.writeControl(OpPing, data)
+}
+
+func (c *Conn) writeControl(op Opcode, data []byte) error {
+	if len(data) > maxControlPayload {
+		return fmt.Errorf("control frame payload of %d bytes exceeds %d", len(data), maxControlPayload)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+	return c.writeFrameLocked(frame{fin: true, opcode: op, payload: data})
+}
+
+// sendClose sends the close frame unless one was already sent. A zero code
+// sends an empty close frame.
+func (c *Conn) sendClose(code int, reason string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return nil
+	}
+	c.closeSent = true
+	var payload []byte
+	if code != 0 {
+		payload = binary.BigEndian.AppendUint16(nil, uint16(code))
+		payload = append(payload, reason...)
+		if len(payload) > maxControlPayload {
+			payload = payload[:maxControlPayload]
+		}
+	}
+	return c.writeFrameLocked(frame{fin: true, opcode: OpClose, payload: payload})
+}
+
+func (c *Conn) writeFrameLocked(f frame) error {
+	if !c.client {
+		return writeFrame(c.conn, f, nil)
+	}
+	var key [4]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return err
+	}
+	return writeFrame(c.conn, f, &key)
+}
+
+// Close starts the closing handshake and closes the connection once the peer
+// answers or Config.CloseTimeout passes. If another goroutine is reading, it
+// receives the peer's close frame and closes the connection instead.
+func (c *Conn) Close(code int, reason string) error {
+	err := c.sendClose(code, reason)
+	c.conn.SetReadDeadline(time.Now().Add(c.config.CloseTimeout))
+	if !c.readMu.TryLock() {
+		return err
+	}
+	defer c.readMu.Unlock()
+	for c.readErr == nil {
+		if _, _, readErr := c.readMessage(); readErr != nil {
+			c.readErr = ErrClosed
+		}
+	}
+	c.conn.Close()
+	return err
+}
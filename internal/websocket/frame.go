@@ -0,0 +1,138 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+type Opcode byte
+
+const (
+	OpContinuation Opcode = 0x0
+	OpText         Opcode = 0x1
+	OpBinary       Opcode = 0x2
+	OpClose        Opcode = 0x8
+	OpPing         Opcode = 0x9
+	OpPong         Opcode = 0xa
+)
+
+func (op Opcode) isControl() bool {
+	return op&0x8 != 0
+}
+
+const maxControlPayload = 125
+
+type frame struct {
+	fin     bool
+	rsv1    bool
+	opcode  Opcode
+	payload []byte
+}
+
+// readFrame reads one frame, unmasking its payload. Data frames longer than
+// limit are refused with CloseMessageTooBig before their payload is read.
+func readFrame(r *bufio.Reader, expectMasked bool, limit int) (frame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{
+		fin:    head[0]&0x80 != 0,
+		rsv1:   head[0]&0x40 != 0,
+		opcode: Opcode(head[0] & 0x0f),
+	}
+	if head[0]&0x30 != 0 {
+		return frame{}, &CloseError{Code: CloseProtocolError, Reason: "reserved bits set"}
+	}
+	masked := head[1]&0x80 != 0
+	if masked != expectMasked {
+		return frame{}, &CloseError{Code: CloseProtocolError, Reason: fmt.Sprintf("frame masking must be %t", expectMasked)}
+	}
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		if length>>63 != 0 {
+			return frame{}, &CloseError{Code: CloseProtocolError, Reason: "invalid payload length"}
+		}
+	}
+	if f.opcode.isControl() {
+		if !f.fin || length > maxControlPayload {
+			return frame{}, &CloseError{Code: CloseProtocolError, Reason: "invalid control frame"}
+		}
+	} else if length > uint64(limit) {
+		return frame{}, &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, key[:]); err != nil {
+			return frame{}, err
+		}
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return frame{}, err
+	}
+	if masked {
+		maskBytes(key, f.payload)
+	}
+	return f, nil
+}
+
+// writeFrame sends f in a single write, masking the payload with key when it
+// is not nil.
+func writeFrame(w io.Writer, f frame, key *[4]byte) error {
+	buf := make([]byte, 0, 14+len(f.payload))
+	b0 := byte(f.opcode)
+	if f.fin {
+		b0 |= 0x80
+	}
+	if f.rsv1 {
+		b0 |= 0x40
+	}
+	var maskBit byte
+	if key != nil {
+		maskBit = 0x80
+	}
+	buf = append(buf, b0)
+	switch n := len(f.payload); {
+	case n <= 125:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+	if key != nil {
+		buf = append(buf, key[:]...)
+		start := len(buf)
+		buf = append(buf, f.payload...)
+		maskBytes(*key, buf[start:])
+	} else {
+		buf = append(buf, f.payload...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
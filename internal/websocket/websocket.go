@@ -0,0 +1,168 @@
+package websocket
+
+import (
+	"compress/flate"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const DefaultMaxMessageSize = 1 << 20
+
+var ErrBadHandshake = errors.New("bad websocket handshake")
+
+type Config struct {
+	// Subprotocols lists the subprotocols the server speaks, most preferred first.
+	Subprotocols []string
+	// CheckOrigin vets the Origin header; nil accepts requests without one and
+	// those whose origin names the same host as the Host header.
+	CheckOrigin func(origin string) bool
+	// MaxMessageSize bounds a reassembled, decompressed message; 0 means DefaultMaxMessageSize.
+	MaxMessageSize int
+	// FragmentSize splits outgoing messages into frames of at most this many
+	// bytes; 0 sends every message in a single frame.
+	FragmentSize int
+	// EnableCompression accepts permessage-deflate when the client offers it.
+	EnableCompression bool
+	// CompressionLevel is a compress/flate level; 0 means flate.BestSpeed.
+	CompressionLevel int
+	// CloseTimeout bounds the wait for the peer's close frame; 0 means 5s.
+	CloseTimeout time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.MaxMessageSize <= 0 {
+		c.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if c.CompressionLevel == 0 {
+		c.CompressionLevel = flate.BestSpeed
+	}
+	if c.CloseTimeout <= 0 {
+		c.CloseTimeout = 5 * time.Second
+	}
+	return c
+}
+
+// Handler upgrades every request to a WebSocket and passes the connection to
+// serve, closing it normally once serve returns.
+func Handler(serve func(c *Conn, req *request.Request), config Config) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		c, err := Upgrade(w, req, config)
+		if err != nil {
+			return
+		}
+		defer c.Close(CloseNormal, "")
+		serve(c, req)
+	}
+}
+
+// Upgrade validates the opening handshake of RFC 6455 section 4.2, sends the
+// 101 response and takes over the connection. When the handshake is invalid
+// it answers with an error response and returns ErrBadHandshake.
+func Upgrade(w *response.Writer, req *request.Request, config Config) (*Conn, error) {
+	key, status, err := checkHandshake(req)
+	if err == nil {
+		checkOrigin := config.CheckOrigin
+		if checkOrigin == nil {
+			host, _ := req.Headers.Get("Host")
+			checkOrigin = func(origin string) bool { return sameOrigin(origin, host) }
+		}
+		if origin, _ := req.Headers.Get("Origin"); !checkOrigin(origin) {
+			status, err = response.StatusCodeForbidden, fmt.Errorf("origin %q not allowed", origin)
+		}
+	}
+	if err != nil {
+		if status == response.StatusCodeUpgradeRequired {
+			w.Header().Override("Upgrade", "websocket")
+			w.Header().Override("Sec-WebSocket-Version", "13")
+		}
+		response.Error(w, status, err.Error())
+		return nil, fmt.Errorf("%w: %v", ErrBadHandshake, err)
+	}
+
+	h := headers.NewHeaders()
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "Upgrade")
+	h.Set("Sec-WebSocket-Accept", acceptKey(key))
+	subprotocol := selectSubprotocol(req, config.Subprotocols)
+	if subprotocol != "" {
+		h.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	extensions, _ := req.Headers.Get("Sec-WebSocket-Extensions")
+	compress := config.EnableCompression && acceptsDeflate(extensions)
+	if compress {
+		h.Set("Sec-WebSocket-Extensions", deflateResponse)
+	}
+	for _, name := range []string{"Content-Type", "Content-Length", "Transfer-Encoding"} {
+		w.Header().Remove(name)
+	}
+	if err := w.WriteStatusLine(response.StatusCodeSwitchingProtocols); err != nil {
+		return nil, err
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return nil, err
+	}
+	conn, buffered, err := w.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	c := newConn(conn, buffered, false, config)
+	c.subprotocol = subprotocol
+	c.compress = compress
+	return c, nil
+}
+
+func checkHandshake(req *request.Request) (string, response.StatusCode, error) {
+	if req.RequestLine.Method != "GET" {
+		return "", response.StatusCodeMethodNotAllowed, fmt.Errorf("websocket handshake must use GET")
+	}
+	if !req.Headers.HasToken("Upgrade", "websocket") || !req.Headers.HasToken("Connection", "upgrade") {
+		return "", response.StatusCodeUpgradeRequired, fmt.Errorf("expected a websocket upgrade")
+	}
+	if version, _ := req.Headers.Get("Sec-WebSocket-Version"); version != "13" {
+		return "", response.StatusCodeUpgradeRequired, fmt.Errorf("unsupported websocket version %q", version)
+	}
+	key, _ := req.Headers.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return "", response.StatusCodeBadRequest, fmt.Errorf("invalid Sec-WebSocket-Key %q", key)
+	}
+	return key, 0, nil
+}
+
+// sameOrigin reports whether a browser's Origin refers to host, so that other
+// sites cannot open connections with the user's cookies. Clients that send no
+// Origin are not browsers and are let through.
+func sameOrigin(origin, host string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return strings.EqualFold(u.Host, host)
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func selectSubprotocol(req *request.Request, supported []string) string {
+	for _, protocol := range supported {
+		if req.Headers.HasToken("Sec-WebSocket-Protocol", protocol) {
+			return protocol
+		}
+	}
+	return ""
+}
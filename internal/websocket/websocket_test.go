@@ -0,0 +1,223 @@
+package websocket
+
+import (
+	"bufio"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const handshake = "GET /chat HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+	"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"
+
+// upgradePair runs Upgrade over a pipe and returns both ends of the
+// connection along with the handshake response the client saw.
+func upgradePair(t *testing.T, config Config, extra string) (*Conn, *Conn, *http.Response) {
+	req, err := request.RequestFromReader(strings.NewReader(handshake + extra + "\r\n"))
+	require.NoError(t, err)
+	clientSide, serverSide := net.Pipe()
+	t.Cleanup(func() { clientSide.Close(); serverSide.Close() })
+
+	type result struct {
+		conn *Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		w := response.NewWriter(serverSide)
+		w.SetHijacker(func() (net.Conn, []byte, error) {
+			return serverSide, nil, nil
+		})
+		c, err := Upgrade(w, req, config)
+		if err != nil {
+			w.Finish()
+			serverSide.Close()
+		}
+		done <- result{c, err}
+	}()
+	br := bufio.NewReader(clientSide)
+	resp, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	res := <-done
+	if res.err != nil {
+		return nil, nil, resp
+	}
+	buffered, _ := br.Peek(br.Buffered())
+	return res.conn, newConn(clientSide, buffered, true, config), resp
+}
+
+func readAsync(c *Conn) chan []byte {
+	ch := make(chan []byte, 1)
+	go func() {
+		_, data, _ := c.ReadMessage()
+		ch <- data
+	}()
+	return ch
+}
+
+func TestUpgrade(t *testing.T) {
+	// Test: Accept key and subprotocol negotiated
+	server, client, resp := upgradePair(t, Config{Subprotocols: []string{"v2", "v1"}}, "Sec-WebSocket-Protocol: v1, v2\r\n")
+	require.NotNil(t, server)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	assert.Equal(t, "websocket", resp.Header.Get("Upgrade"))
+	assert.Equal(t, "v2", resp.Header.Get("Sec-WebSocket-Protocol"))
+	assert.Equal(t, "v2", server.Subprotocol())
+	assert.Empty(t, resp.Header.Get("Sec-WebSocket-Extensions"))
+
+	// Test: Messages flow both ways
+	got := readAsync(server)
+	require.NoError(t, client.WriteMessage(OpText, []byte("hello")))
+	assert.Equal(t, "hello", string(<-got))
+	got = readAsync(client)
+	require.NoError(t, server.WriteMessage(OpBinary, []byte{1, 2, 3}))
+	assert.Equal(t, []byte{1, 2, 3}, <-got)
+
+	// Test: Malformed key rejected
+	_, _, resp = upgradePair(t, Config{}, "Sec-WebSocket-Key: short\r\n")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Test: Wrong version asks for 13
+	req, err := request.RequestFromReader(strings.NewReader(strings.Replace(handshake, "Version: 13", "Version: 8", 1) + "\r\n"))
+	require.NoError(t, err)
+	var buf strings.Builder
+	w := response.NewWriter(&buf)
+	_, err = Upgrade(w, req, Config{})
+	assert.ErrorIs(t, err, ErrBadHandshake)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "HTTP/1.1 426 Upgrade Required")
+	assert.Contains(t, buf.String(), "sec-websocket-version: 13")
+
+	// Test: Disallowed origin refused
+	_, _, resp = upgradePair(t, Config{CheckOrigin: func(origin string) bool { return origin == "https://ok.test" }}, "Origin: https://evil.test\r\n")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Test: Cross-site origin refused by default
+	_, _, resp = upgradePair(t, Config{}, "Origin: https://evil.test\r\n")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Test: Same-origin request accepted by default
+	server, _, resp = upgradePair(t, Config{}, "Origin: https://Example.com\r\n")
+	require.NotNil(t, server)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+}
+
+func TestFragmentationAndControlFrames(t *testing.T) {
+	server, client, _ := upgradePair(t, Config{FragmentSize: 4}, "")
+	pongs := make(chan string, 1)
+	client.SetPongHandler(func(data []byte) { pongs <- string(data) })
+
+	// Test: Ping interleaved with fragments is answered and the message reassembled
+	got := readAsync(server)
+	require.NoError(t, writeFrame(client.conn, frame{opcode: OpText, payload: []byte("frag")}, &[4]byte{1, 2, 3, 4}))
+	require.NoError(t, writeFrame(client.conn, frame{fin: true, opcode: OpPing, payload: []byte("p")}, &[4]byte{5, 6, 7, 8}))
+	clientGot := readAsync(client)
+	assert.Equal(t, "p", <-pongs)
+	require.NoError(t, writeFrame(client.conn, frame{fin: true, opcode: OpContinuation, payload: []byte("ment")}, &[4]byte{9, 9, 9, 9}))
+	assert.Equal(t, "fragment", string(<-got))
+
+	// Test: Outgoing messages split by FragmentSize
+	require.NoError(t, server.WriteMessage(OpText, []byte("0123456789")))
+	assert.Equal(t, "0123456789", string(<-clientGot))
+
+	// Test: Close handshake reports the peer's code
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := server.ReadMessage()
+		errs <- err
+	}()
+	require.NoError(t, client.Close(CloseGoingAway, "bye"))
+	err := <-errs
+	var closeErr *CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseGoingAway, closeErr.Code)
+	assert.Equal(t, "bye", closeErr.Reason)
+	assert.ErrorIs(t, server.WriteMessage(OpText, []byte("late")), ErrClosed)
+
+	// Test: Registered codes above 1011 accepted
+	server, client, _ = upgradePair(t, Config{}, "")
+	go func() {
+		_, _, err := server.ReadMessage()
+		errs <- err
+	}()
+	require.NoError(t, client.Close(CloseServiceRestart, "restart"))
+	require.ErrorAs(t, <-errs, &closeErr)
+	assert.Equal(t, CloseServiceRestart, closeErr.Code)
+}
+
+func TestProtocolViolations(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame frame
+		key   *[4]byte
+		code  int
+	}{
+		{"unmasked client frame", frame{fin: true, opcode: OpText, payload: []byte("x")}, nil, CloseProtocolError},
+		{"message over the limit", frame{fin: true, opcode: OpBinary, payload: make([]byte, 17)}, &[4]byte{1, 1, 1, 1}, CloseMessageTooBig},
+		{"invalid UTF-8", frame{fin: true, opcode: OpText, payload: []byte{0xff, 0xfe}}, &[4]byte{1, 1, 1, 1}, CloseInvalidPayload},
+		{"compressed without negotiation", frame{fin: true, rsv1: true, opcode: OpText, payload: []byte("x")}, &[4]byte{1, 1, 1, 1}, CloseProtocolError},
+		{"unknown opcode", frame{fin: true, opcode: 0x3}, &[4]byte{1, 1, 1, 1}, CloseProtocolError},
+	}
+	for _, tt := range tests {
+		// Test: Server fails the connection with the matching close code
+		server, client, _ := upgradePair(t, Config{MaxMessageSize: 16}, "")
+		errs := make(chan error, 1)
+		go func() {
+			_, _, err := server.ReadMessage()
+			errs <- err
+		}()
+		clientErr := make(chan error, 1)
+		go func() {
+			_, _, err := client.ReadMessage()
+			clientErr <- err
+		}()
+		writeFrame(client.conn, tt.frame, tt.key)
+		var closeErr *CloseError
+		require.ErrorAs(t, <-errs, &closeErr, tt.name)
+		assert.Equal(t, tt.code, closeErr.Code, tt.name)
+		require.ErrorAs(t, <-clientErr, &closeErr, tt.name)
+		assert.Equal(t, tt.code, closeErr.Code, tt.name)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	// Test: permessage-deflate negotiated when offered
+	config := Config{EnableCompression: true, FragmentSize: 8, CloseTimeout: time.Second}
+	server, client, resp := upgradePair(t, config, "Sec-WebSocket-Extensions: permessage-deflate; client_max_window_bits\r\n")
+	require.NotNil(t, server)
+	assert.Equal(t, deflateResponse, resp.Header.Get("Sec-WebSocket-Extensions"))
+	client.compress = true
+
+	// Test: Compressed, fragmented messages round-trip
+	message := strings.Repeat("compress me ", 50)
+	got := readAsync(server)
+	require.NoError(t, client.WriteMessage(OpText, []byte(message)))
+	assert.Equal(t, message, string(<-got))
+	got = readAsync(client)
+	require.NoError(t, server.WriteMessage(OpText, []byte(message)))
+	assert.Equal(t, message, string(<-got))
+
+	// Test: Limit applies to the decompressed size
+	bomb, err := deflate(make([]byte, 4096), config.CompressionLevel)
+	require.NoError(t, err)
+	_, err = inflate(bomb, 1024)
+	var closeErr *CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseMessageTooBig, closeErr.Code)
+
+	// Test: Offers this side cannot honour are declined
+	assert.False(t, acceptsDeflate("permessage-deflate; server_max_window_bits=10"))
+	assert.True(t, acceptsDeflate("permessage-deflate; server_max_window_bits=10, permessage-deflate"))
+	assert.False(t, acceptsDeflate("x-webkit-deflate-frame"))
+}